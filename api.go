@@ -44,6 +44,11 @@ type MessageContent struct {
 }
 
 func ApiSendMessage(ctx *gin.Context) {
+	engine.ApiSendMessage(ctx)
+}
+
+// ApiSendMessage 对外的消息发送接口
+func (bot *Bot) ApiSendMessage(ctx *gin.Context) {
 	body := &MessageContent{}
 	err := ctx.ShouldBindJSON(body)
 	if err != nil {
@@ -59,12 +64,12 @@ func ApiSendMessage(ctx *gin.Context) {
 	}
 	switch body.Type {
 	case "privacy":
-		_, err := SendToPrivacy(body.Number, chain)
+		_, err := bot.SendToPrivacy(body.Number, chain)
 		if err != nil {
 			Error(ctx, "发送失败！")
 		}
 	case "group":
-		_, err := SendToGroup(body.Number, chain)
+		_, err := bot.SendToGroup(body.Number, chain)
 		if err != nil {
 			Error(ctx, "发送失败！")
 			return
@@ -0,0 +1,375 @@
+package ranni
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const defaultCommandPrefix = "/"
+
+// ArgType 命令参数类型
+type ArgType int
+
+const (
+	ArgString ArgType = iota // 单个词
+	ArgInt                   // 整数
+	ArgFloat                 // 小数
+	ArgBool                  // true/false、yes/no、on/off、1/0
+	ArgAt                    // @某人或QQ号
+	ArgText                  // 剩余的全部文本，只能作为最后一个参数
+)
+
+func (argType ArgType) String() string {
+	switch argType {
+	case ArgString:
+		return "string"
+	case ArgInt:
+		return "int"
+	case ArgFloat:
+		return "float"
+	case ArgBool:
+		return "bool"
+	case ArgAt:
+		return "at"
+	case ArgText:
+		return "text"
+	default:
+		return "unknown"
+	}
+}
+
+// Arg 命令参数声明
+type Arg struct {
+	Name        string
+	Type        ArgType
+	Optional    bool        // 可选参数需放在必填参数之后
+	Default     interface{} // 可选参数缺省时的值
+	Description string
+}
+
+// Command 命令声明，实现了EventHandler，可直接Register。
+// 前缀由Config.CommandPrefixes配置，解析后的参数通过EventContext.Args获取，参数错误时自动回复用法
+type Command struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Args        []Arg
+	Subcommands []*Command
+	Handler     func(ctx *EventContext) // 为空时回复子命令用法
+}
+
+// CommandArgs 解析后的命令参数，key为参数名
+type CommandArgs map[string]interface{}
+
+func (args CommandArgs) Has(name string) bool {
+	_, ok := args[name]
+	return ok
+}
+
+func (args CommandArgs) GetString(name string) string {
+	value, _ := args[name].(string)
+	return value
+}
+
+// GetInt 获取ArgInt或ArgAt参数
+func (args CommandArgs) GetInt(name string) int64 {
+	value, _ := args[name].(int64)
+	return value
+}
+
+func (args CommandArgs) GetFloat(name string) float64 {
+	value, _ := args[name].(float64)
+	return value
+}
+
+func (args CommandArgs) GetBool(name string) bool {
+	value, _ := args[name].(bool)
+	return value
+}
+
+// commandToken 命令中的一个词，at不为0时为@消息
+type commandToken struct {
+	text string
+	at   int64
+}
+
+// commandMatch 命令匹配结果
+type commandMatch struct {
+	prefix string
+	path   []*Command // 从根命令到匹配的子命令
+	tokens []commandToken
+}
+
+func (command *Command) Filter(ctx *EventContext) bool {
+	_, ok := command.match(ctx)
+	return ok
+}
+
+func (command *Command) Do(ctx *EventContext) {
+	match, ok := command.match(ctx)
+	if !ok {
+		return
+	}
+	target := match.path[len(match.path)-1]
+	if target.Handler == nil {
+		replyUsage(ctx, match, "")
+		return
+	}
+	args, err := parseArgs(target.Args, match.tokens)
+	if err != nil {
+		replyUsage(ctx, match, err.Error())
+		return
+	}
+	// 复制上下文，避免同一事件的其他handler读到本命令的参数
+	commandCtx := *ctx
+	commandCtx.Args = args
+	target.Handler(&commandCtx)
+}
+
+func (command *Command) Help() string {
+	return command.Usage(defaultCommandPrefix)
+}
+
+// Usage 根据声明生成命令及其子命令的用法说明
+func (command *Command) Usage(prefix string) string {
+	var lines []string
+	command.usageLines(prefix+command.Name, &lines)
+	return strings.Join(lines, "\n")
+}
+
+func (command *Command) usageLines(path string, lines *[]string) {
+	if command.Handler != nil || len(command.Subcommands) == 0 {
+		line := path
+		for _, arg := range command.Args {
+			line += " " + arg.usage()
+		}
+		if command.Description != "" {
+			line += "：" + command.Description
+		}
+		if len(command.Aliases) != 0 {
+			line += "（别名：" + strings.Join(command.Aliases, "、") + "）"
+		}
+		*lines = append(*lines, line)
+	} else if command.Description != "" {
+		*lines = append(*lines, path+"："+command.Description)
+	}
+	for _, sub := range command.Subcommands {
+		sub.usageLines(path+" "+sub.Name, lines)
+	}
+}
+
+func (arg Arg) usage() string {
+	name := arg.Name
+	if arg.Type == ArgText {
+		name += "..."
+	}
+	if arg.Optional {
+		return "[" + name + "]"
+	}
+	return "<" + name + ">"
+}
+
+func (command *Command) is(name string) bool {
+	if strings.EqualFold(command.Name, name) {
+		return true
+	}
+	for _, alias := range command.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// match 判断消息是否调用了该命令，消息开头@bot的部分会被忽略
+func (command *Command) match(ctx *EventContext) (*commandMatch, bool) {
+	if ctx.EventType != GroupMessageEventType && ctx.EventType != PrivacyMessageEventType {
+		return nil, false
+	}
+	tokens := tokenize(ctx.MessageChain)
+	for len(tokens) > 0 && tokens[0].at != 0 && tokens[0].at == ctx.SelfId {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 || tokens[0].at != 0 {
+		return nil, false
+	}
+	for _, prefix := range ctx.Bot.commandPrefixes() {
+		if !strings.HasPrefix(tokens[0].text, prefix) || !command.is(strings.TrimPrefix(tokens[0].text, prefix)) {
+			continue
+		}
+		match := &commandMatch{prefix: prefix, path: []*Command{command}, tokens: tokens[1:]}
+		for len(match.tokens) > 0 {
+			sub := match.path[len(match.path)-1].subcommand(match.tokens[0])
+			if sub == nil {
+				break
+			}
+			match.path = append(match.path, sub)
+			match.tokens = match.tokens[1:]
+		}
+		return match, true
+	}
+	return nil, false
+}
+
+func (command *Command) subcommand(token commandToken) *Command {
+	if token.at != 0 {
+		return nil
+	}
+	for _, sub := range command.Subcommands {
+		if sub.is(token.text) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// commandPrefixes 命令前缀，未配置时为"/"
+func (bot *Bot) commandPrefixes() []string {
+	if bot == nil || bot.config == nil || len(bot.config.CommandPrefixes) == 0 {
+		return []string{defaultCommandPrefix}
+	}
+	return bot.config.CommandPrefixes
+}
+
+func replyUsage(ctx *EventContext, match *commandMatch, reason string) {
+	names := make([]string, 0, len(match.path))
+	for _, command := range match.path {
+		names = append(names, command.Name)
+	}
+	var lines []string
+	match.path[len(match.path)-1].usageLines(match.prefix+strings.Join(names, " "), &lines)
+	text := "用法：\n" + strings.Join(lines, "\n")
+	if reason != "" {
+		text = "参数错误：" + reason + "\n" + text
+	}
+	replyText(ctx, text)
+}
+
+// replyText 在当前会话中回复文本，失败时记录日志
+func replyText(ctx *EventContext, text string) {
+	if _, err := ctx.Send(InitMsgChain(TextMessage{Text: text})); err != nil {
+		log.Println("回复消息失败：", err)
+	}
+}
+
+// tokenize 将消息链拆分为词，文本按空白分割，可用双引号包含空格
+func tokenize(chain *MessageChain) []commandToken {
+	var tokens []commandToken
+	if chain == nil {
+		return tokens
+	}
+	for _, message := range chain.GetMessages() {
+		switch m := message.(type) {
+		case TextMessage:
+			for _, field := range splitFields(m.Text) {
+				tokens = append(tokens, commandToken{text: field})
+			}
+		case AtMessage:
+			if !m.AtAll {
+				tokens = append(tokens, commandToken{text: strconv.FormatInt(m.Qq, 10), at: m.Qq})
+			}
+		}
+	}
+	return tokens
+}
+
+func splitFields(text string) []string {
+	var fields []string
+	var field strings.Builder
+	quoted, hasField := false, false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			hasField = true
+		case unicode.IsSpace(r) && !quoted:
+			if hasField {
+				fields = append(fields, field.String())
+				field.Reset()
+				hasField = false
+			}
+		default:
+			field.WriteRune(r)
+			hasField = true
+		}
+	}
+	if hasField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+func parseArgs(declared []Arg, tokens []commandToken) (CommandArgs, error) {
+	args := CommandArgs{}
+	pos := 0
+	for _, arg := range declared {
+		if pos >= len(tokens) {
+			if !arg.Optional {
+				return nil, fmt.Errorf("缺少参数%s", arg.Name)
+			}
+			if arg.Default != nil {
+				args[arg.Name] = arg.Default
+			}
+			continue
+		}
+		if arg.Type == ArgText {
+			texts := make([]string, 0, len(tokens)-pos)
+			for _, token := range tokens[pos:] {
+				texts = append(texts, token.text)
+			}
+			args[arg.Name] = strings.Join(texts, " ")
+			pos = len(tokens)
+			continue
+		}
+		value, err := arg.parse(tokens[pos])
+		if err != nil {
+			return nil, err
+		}
+		args[arg.Name] = value
+		pos++
+	}
+	if pos < len(tokens) {
+		return nil, errors.New("多余的参数" + tokens[pos].text)
+	}
+	return args, nil
+}
+
+func (arg Arg) parse(token commandToken) (interface{}, error) {
+	switch arg.Type {
+	case ArgInt:
+		value, err := strconv.ParseInt(token.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s需要是整数：%s", arg.Name, token.text)
+		}
+		return value, nil
+	case ArgFloat:
+		value, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s需要是数字：%s", arg.Name, token.text)
+		}
+		return value, nil
+	case ArgBool:
+		switch strings.ToLower(token.text) {
+		case "true", "yes", "on", "1", "是", "开":
+			return true, nil
+		case "false", "no", "off", "0", "否", "关":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%s需要是true或false：%s", arg.Name, token.text)
+	case ArgAt:
+		if token.at != 0 {
+			return token.at, nil
+		}
+		value, err := strconv.ParseInt(strings.TrimPrefix(token.text, "@"), 10, 64)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("%s需要@某人或填写QQ号：%s", arg.Name, token.text)
+		}
+		return value, nil
+	default:
+		return token.text, nil
+	}
+}
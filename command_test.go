@@ -0,0 +1,56 @@
+package ranni
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommand_Do(t *testing.T) {
+	bot := New(&Config{CommandPrefixes: []string{"/", "!"}})
+	var got CommandArgs
+	command := &Command{
+		Name:        "roll",
+		Aliases:     []string{"r"},
+		Description: "掷骰子",
+		Subcommands: []*Command{{
+			Name: "dice",
+			Args: []Arg{
+				{Name: "sides", Type: ArgInt},
+				{Name: "target", Type: ArgAt, Optional: true},
+				{Name: "note", Type: ArgText, Optional: true, Default: "无"},
+			},
+			Handler: func(ctx *EventContext) { got = ctx.Args },
+		}},
+	}
+	event := GroupMessageEvent{GroupId: 1}
+	event.SelfId = 10000
+	event.MessageChain = *NewMsgChain().AddAt(10000).AddText(" !r dice 20 ").AddAt(123).AddText(` "暗 骰"`)
+	ctx := bot.newEventContext(event)
+	if !command.Filter(ctx) {
+		t.Fatal("command not matched")
+	}
+	command.Do(ctx)
+	if got.GetInt("sides") != 20 || got.GetInt("target") != 123 || got.GetString("note") != "暗 骰" {
+		t.Errorf("args = %v", got)
+	}
+	if ctx.Args != nil {
+		t.Error("args leaked into shared context")
+	}
+
+	event.MessageChain = *NewMsgChain().AddText("roll dice 20")
+	if command.Filter(bot.newEventContext(event)) {
+		t.Error("matched without prefix")
+	}
+
+	if _, err := parseArgs(command.Subcommands[0].Args, []commandToken{{text: "abc"}}); err == nil {
+		t.Error("expected int parse error")
+	}
+	if _, err := parseArgs(command.Subcommands[0].Args, nil); err == nil {
+		t.Error("expected missing argument error")
+	}
+
+	usage := command.Usage("!")
+	if !strings.Contains(usage, "!roll dice <sides> [target] [note...]") {
+		t.Errorf("usage = %q", usage)
+	}
+}
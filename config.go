@@ -1,8 +1,120 @@
 package ranni
 
+import "time"
+
 type Config struct {
+	ProtocolVersion int `yaml:"protocol_version"` // OneBot协议版本，11(默认)或12
+
 	WsAddr       string `yaml:"ws_addr"`
 	CallBackAddr string `yaml:"call_back_addr"`
 	AccessToken  string `yaml:"access_token"`
 	ApiAddr      string `yaml:"api_addr"` // API端口
+
+	UseTLS             bool   `yaml:"use_tls"`              // WsAddr、CallBackAddr未写协议时使用wss、https
+	CACertFile         string `yaml:"ca_cert_file"`         // 自定义CA证书，用于校验自签名的服务端证书
+	ClientCertFile     string `yaml:"client_cert_file"`     // 双向认证的客户端证书
+	ClientKeyFile      string `yaml:"client_key_file"`      // 双向认证的客户端私钥
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 跳过服务端证书校验，仅用于调试
+	Proxy              string `yaml:"proxy"`                // 代理地址，支持http://、https://、socks5://，为空时读取环境变量
+	TokenInHeader      bool   `yaml:"token_in_header"`      // 通过Authorization: Bearer请求头发送access token，不再拼接到url中
+
+	ReverseWs     bool   `yaml:"reverse_ws"`      // 是否使用反向ws，开启后不再主动连接WsAddr
+	ReverseWsAddr string `yaml:"reverse_ws_addr"` // 反向ws监听地址，为空时挂载在API服务上
+	ReverseWsPath string `yaml:"reverse_ws_path"` // 反向ws路径，默认/onebot/v11/ws
+
+	HttpPost     bool   `yaml:"http_post"`      // 是否通过http post接收事件，开启后不再主动连接WsAddr
+	HttpPostAddr string `yaml:"http_post_addr"` // http post监听地址，为空时挂载在API服务上
+	HttpPostPath string `yaml:"http_post_path"` // http post路径，默认/onebot/v11/http
+	Secret       string `yaml:"secret"`         // http post签名密钥，为空时不校验X-Signature
+
+	ActionTransport string        `yaml:"action_transport"` // 调用action的通道，http(默认)或ws
+	ActionTimeout   time.Duration `yaml:"action_timeout"`   // 通过ws调用action的超时时间，默认30s
+
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // 退出时等待handler及定时任务结束的最长时间，默认10s
+	HandlerTimeout  time.Duration `yaml:"handler_timeout"`  // 单个事件的处理时限，超时后取消EventContext.Context()，0为不限制
+
+	HeartbeatTimeout   time.Duration `yaml:"heartbeat_timeout"`   // 超过该时间未收到心跳视为超时，默认为心跳间隔的两倍
+	HeartbeatReconnect bool          `yaml:"heartbeat_reconnect"` // 心跳超时时是否断开连接重连
+
+	RateLimit RateLimitConfig `yaml:"rate_limit"` // 消息发送限速
+
+	WorkerPool      WorkerPoolConfig `yaml:"worker_pool"`      // 事件处理协程池，未开启时每个事件及handler各使用一个协程
+	OrderedDispatch bool             `yaml:"ordered_dispatch"` // 同一会话(GetSubjectId)的事件按到达顺序依次处理，不同会话仍并行；handler调用WaitNext后不再阻塞该会话
+
+	SuperUsers []int64 `yaml:"super_users"` // bot超级用户，拥有全部权限
+
+	Admins           []int64       `yaml:"admins"`            // 管理员QQ号，handler被熔断暂停时私聊通知
+	BreakerThreshold int           `yaml:"breaker_threshold"` // handler在BreakerWindow内panic达到该次数后暂停，0为不启用
+	BreakerWindow    time.Duration `yaml:"breaker_window"`    // panic次数的统计窗口，默认1min
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // handler暂停时长，默认10min
+
+	StorePath string `yaml:"store_path"` // 权限、功能开关及开启Persist的冷却与配额的持久化文件，为空时保存在内存
+
+	CommandPrefixes []string `yaml:"command_prefixes"` // 命令前缀，默认为"/"，包含空字符串时允许不带前缀
+
+	ReconnectMaxRetries  int           `yaml:"reconnect_max_retries"`  // 最大连续重连次数，小于等于0时不限制
+	ReconnectInterval    time.Duration `yaml:"reconnect_interval"`     // 重连初始等待时间，默认1s
+	ReconnectMaxInterval time.Duration `yaml:"reconnect_max_interval"` // 重连最大等待时间，默认1min
+}
+
+func (config *Config) reconnectInterval() time.Duration {
+	if config.ReconnectInterval <= 0 {
+		return defaultReconnectInterval
+	}
+	return config.ReconnectInterval
+}
+
+func (config *Config) reconnectMaxInterval() time.Duration {
+	if config.ReconnectMaxInterval <= 0 {
+		return defaultReconnectMaxInterval
+	}
+	return config.ReconnectMaxInterval
+}
+
+func (config *Config) reverseWsPath() string {
+	if config.ReverseWsPath == "" {
+		if config.ProtocolVersion == OneBot12 {
+			return "/onebot/v12/ws"
+		}
+		return defaultReverseWsPath
+	}
+	return config.ReverseWsPath
+}
+
+func (config *Config) httpPostPath() string {
+	if config.HttpPostPath == "" {
+		if config.ProtocolVersion == OneBot12 {
+			return "/onebot/v12/http"
+		}
+		return defaultHttpPostPath
+	}
+	return config.HttpPostPath
+}
+
+func (config *Config) actionTimeout() time.Duration {
+	if config.ActionTimeout <= 0 {
+		return defaultActionTimeout
+	}
+	return config.ActionTimeout
+}
+
+func (config *Config) shutdownTimeout() time.Duration {
+	if config.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return config.ShutdownTimeout
+}
+
+func (config *Config) breakerWindow() time.Duration {
+	if config.BreakerWindow <= 0 {
+		return defaultBreakerWindow
+	}
+	return config.BreakerWindow
+}
+
+func (config *Config) breakerCooldown() time.Duration {
+	if config.BreakerCooldown <= 0 {
+		return defaultBreakerCooldown
+	}
+	return config.BreakerCooldown
 }
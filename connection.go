@@ -0,0 +1,48 @@
+package ranni
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ConnectionState 与go-cqhttp之间的连接状态
+type ConnectionState int
+
+const (
+	Connected    ConnectionState = iota // 已连接
+	Disconnected                        // 连接断开
+	Reconnecting                        // 等待重连
+)
+
+func (state ConnectionState) String() string {
+	switch state {
+	case Connected:
+		return "connected"
+	case Disconnected:
+		return "disconnected"
+	case Reconnecting:
+		return "reconnecting"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionStateHandler 连接状态变化回调，err为引起断开或重连的原因，可能为nil
+type ConnectionStateHandler func(state ConnectionState, err error)
+
+const (
+	defaultReconnectInterval    = time.Second
+	defaultReconnectMaxInterval = time.Minute
+)
+
+// backoffDelay 计算第attempt次重连前的等待时间，指数退避并加入随机抖动
+func backoffDelay(attempt int, base time.Duration, max time.Duration) time.Duration {
+	delay := max
+	if attempt < 32 {
+		if d := base << uint(attempt); d > 0 && d < max {
+			delay = d
+		}
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -1,13 +1,13 @@
 package ranni
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	json "github.com/json-iterator/go"
 	"log"
-	"net/url"
 	"os"
-	"strconv"
 	"time"
 )
 
@@ -21,6 +21,8 @@ const (
 	GetLoginInfo        = "/get_login_info"         //获取登录账号信息
 	GetGroupMessageList = "/get_group_msg_history"  // 获取群历史消息
 	GetRecord           = "/get_record"             //获取语音
+	SetFriendAddRequest = "/set_friend_add_request" //处理加好友请求
+	SetGroupAddRequest  = "/set_group_add_request"  //处理加群请求或邀请
 )
 
 type EventContext struct {
@@ -28,23 +30,53 @@ type EventContext struct {
 	SelfId        int64         //robot的QQ号
 	UserId        int64         //发送人QQ
 	GroupId       int64         //群号
+	OperatorId    int64         //操作者QQ，仅通知事件
+	TargetId      int64         //被操作对象QQ，仅戳一戳、运气王通知
 	Sender        Sender        //发送人详细信息
 	MessageChain  *MessageChain //消息链
 	OriginalEvent Event
+	Bot           *Bot                   //产生该事件的bot
 	Values        map[string]interface{} //携带的参数
+	Args          CommandArgs            //命令参数，仅在Command的Handler中有值
+	Handler       EventHandler           //当前执行的handler，每个handler拥有独立的EventContext副本
+	HandlerId     string                 //当前执行的handler的ID
+
+	quick   *quickOperation //http post模式下的快速操作
+	stopped *int32          //是否已停止传播，各handler的副本共享
+	subject *subjectLease   //开启OrderedDispatch时对会话的占用
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// Context 返回事件的context，所有handler执行完毕、超过HandlerTimeout或bot停止等待超时后取消，
+// 通过EventContext调用的action均受其约束
+func (event *EventContext) Context() context.Context {
+	if event.ctx == nil {
+		return context.Background()
+	}
+	return event.ctx
 }
 
-// GetSubjectId 获取聊天主题Id
+// GetSubjectId 获取聊天主题Id，通知事件发生在群内时为群号，否则为QQ号
 func (event *EventContext) GetSubjectId() int64 {
 	if event.EventType == GroupMessageEventType {
 		return event.GroupId
 	} else if event.EventType == PrivacyMessageEventType {
 		return event.UserId
+	} else if event.GroupId != 0 {
+		return event.GroupId
+	} else if event.UserId != 0 {
+		return event.UserId
 	} else {
 		return -1
 	}
 }
 
+// isGroup 事件是否发生在群内
+func (event *EventContext) isGroup() bool {
+	return event.EventType != PrivacyMessageEventType && event.GroupId != 0
+}
+
 type MessageCallBack struct {
 	Data struct {
 		MessageId int32 `json:"message_id"`
@@ -52,6 +84,8 @@ type MessageCallBack struct {
 	RetCode int    `json:"retcode"`
 	Status  string `json:"status"`
 	Wording string `json:"wording"`
+
+	bot *Bot
 }
 
 func FetchAvatarUrl(qq int64) string {
@@ -65,8 +99,11 @@ func (messageCallBack MessageCallBack) ReCall(sec int) {
 	}
 	go func() {
 		time.Sleep(time.Duration(sec) * time.Second)
-		var u = robotConfig.CallBackAddr + DeleteMessage
-		err := PostJson(u, messageCallBack.Data, nil)
+		bot := messageCallBack.bot
+		if bot == nil {
+			bot = engine
+		}
+		err := bot.callAction(context.Background(), DeleteMessage, messageCallBack.Data, nil)
 		if err != nil {
 			log.Println(err.Error())
 		}
@@ -86,10 +123,35 @@ type SendMessageMO struct {
 }
 
 func (event *EventContext) Send(message *MessageChain) (*MessageCallBack, error) {
-	return send(event.EventType, event.GetSubjectId(), message)
+	if event.isGroup() {
+		return event.Bot.send(event.Context(), GroupMessageEventType, event.GroupId, message)
+	}
+	return event.Bot.send(event.Context(), PrivacyMessageEventType, event.UserId, message)
 }
 
-func send(eventType EventType, id int64, message *MessageChain) (*MessageCallBack, error) {
+// SendAsync 异步回复当前会话，开启限速时按会话顺序排队发送。
+// 发送不受事件context约束，handler返回后仍会继续，bot停止时取消
+func (event *EventContext) SendAsync(message *MessageChain) *SendFuture {
+	if event.isGroup() {
+		return event.Bot.sendAsyncTo(event.Bot.baseCtx, GroupMessageEventType, event.GroupId, message)
+	}
+	return event.Bot.sendAsyncTo(event.Bot.baseCtx, PrivacyMessageEventType, event.UserId, message)
+}
+
+func (bot *Bot) send(ctx context.Context, eventType EventType, id int64, message *MessageChain) (*MessageCallBack, error) {
+	if !bot.config.RateLimit.Enable {
+		return bot.sendNow(ctx, eventType, id, message)
+	}
+	return bot.sendAsyncTo(ctx, eventType, id, message).WaitContext(ctx)
+}
+
+func (bot *Bot) sendAsyncTo(ctx context.Context, eventType EventType, id int64, message *MessageChain) *SendFuture {
+	return bot.sendAsync(ctx, sendKey(eventType, id), func() (*MessageCallBack, error) {
+		return bot.sendNow(ctx, eventType, id, message)
+	})
+}
+
+func (bot *Bot) sendNow(ctx context.Context, eventType EventType, id int64, message *MessageChain) (*MessageCallBack, error) {
 	mo := buildMessageMO(message)
 	var msgMO = SendMessageMO{
 		MessageType: eventType.String(),
@@ -97,12 +159,12 @@ func send(eventType EventType, id int64, message *MessageChain) (*MessageCallBac
 		GroupId:     id,
 		Message:     *mo,
 	}
-	var u = robotConfig.CallBackAddr + SendMessage
 	back := &MessageCallBack{}
-	err := PostJson(u, msgMO, back)
+	err := bot.callAction(ctx, SendMessage, msgMO, back)
 	if err != nil {
 		return nil, err
 	}
+	back.bot = bot
 	return back, nil
 }
 
@@ -120,15 +182,20 @@ type MessageReq struct {
 }
 
 func (event *EventContext) GetMessage(messageId string) (messageChain MessageChain, err error) {
-	message := new(interface{})
-	_ = PostJson(robotConfig.CallBackAddr+GetMessage, MessageReq{
+	body, err := event.Bot.callActionBody(event.Context(), GetMessage, MessageReq{
 		MessageId: messageId,
-	}, &message)
-	toString, err := json.MarshalToString(message)
-	get := json.Get([]byte(toString), "data", "message")
+	})
+	if err != nil {
+		return MessageChain{}, err
+	}
+	get := json.Get(body, "data", "message")
 	return JsonToMessageChain(get), nil
 }
 
+type GroupReq struct {
+	GroupId int64 `json:"group_id"`
+}
+
 type GroupMemberList struct {
 	Data    []GroupMemberData `json:"data"`
 	RetCode int               `json:"retcode"`
@@ -154,10 +221,8 @@ type GroupMemberData struct {
 }
 
 func (event *EventContext) FetchGroupMemberList() (*GroupMemberList, error) {
-	values := url.Values{}
-	values.Set("group_id", strconv.FormatInt(event.GroupId, 10))
 	resp := &GroupMemberList{}
-	err := GetWithParams(robotConfig.CallBackAddr+GetGroupMemberList, values, resp)
+	err := event.Bot.callAction(event.Context(), GetGroupMemberList, GroupReq{GroupId: event.GroupId}, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -176,44 +241,84 @@ type BotInfoMO struct {
 }
 
 func GetGroupMsg(groupId int64) []GroupMessageEvent {
-	values := url.Values{}
-	values.Set("group_id", strconv.FormatInt(groupId, 10))
-	values.Set("message_seq", "")
-	err, body := GetBodyWithParams(robotConfig.CallBackAddr+GetGroupMessageList, values)
+	return engine.GetGroupMsg(groupId)
+}
+
+// GetGroupMsg 获取群历史消息，失败时返回nil，需要错误信息时使用FetchGroupMsg
+func (bot *Bot) GetGroupMsg(groupId int64) []GroupMessageEvent {
+	result, err := bot.FetchGroupMsg(groupId)
 	if err != nil {
-		log.Println("获取bot信息异常", err.Error())
+		log.Println("获取群历史消息异常", err.Error())
 		return nil
 	}
+	return result
+}
+
+// FetchGroupMsg 获取群历史消息
+func (bot *Bot) FetchGroupMsg(groupId int64) ([]GroupMessageEvent, error) {
+	return bot.FetchGroupMsgContext(context.Background(), groupId)
+}
+
+func (bot *Bot) FetchGroupMsgContext(ctx context.Context, groupId int64) ([]GroupMessageEvent, error) {
+	body, err := bot.callActionBody(ctx, GetGroupMessageList, GroupReq{GroupId: groupId})
+	if err != nil {
+		return nil, err
+	}
 	var arr []json.Any
 	json.Get(body, "data", "messages").ToVal(&arr)
 	var result []GroupMessageEvent
 	for _, item := range arr {
 		decode, err := messageEventDecode([]byte(item.ToString()))
 		if err != nil {
-			return nil
+			return nil, err
 		}
 		groupMsgEvent := decode.(GroupMessageEvent)
 		result = append(result, groupMsgEvent)
 	}
-	return result
+	return result, nil
 }
 
 func GetBotInfo() *BotInfo {
-	values := url.Values{}
-	resp := &BotInfoMO{}
-	err := GetWithParams(robotConfig.CallBackAddr+GetLoginInfo, values, resp)
+	return engine.GetBotInfo()
+}
+
+// GetBotInfo 获取登录账号信息，失败时返回nil，需要错误信息时使用FetchBotInfo
+func (bot *Bot) GetBotInfo() *BotInfo {
+	info, err := bot.FetchBotInfo()
 	if err != nil {
 		log.Println("获取bot信息异常", err.Error())
 		return nil
 	}
-	return &resp.Data
+	return info
+}
+
+// FetchBotInfo 获取登录账号信息
+func (bot *Bot) FetchBotInfo() (*BotInfo, error) {
+	return bot.FetchBotInfoContext(context.Background())
+}
+
+func (bot *Bot) FetchBotInfoContext(ctx context.Context) (*BotInfo, error) {
+	resp := &BotInfoMO{}
+	err := bot.callAction(ctx, GetLoginInfo, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
 }
 
 func GetRecordFile(fileName string) (error, []byte) {
-	params := url.Values{}
-	params.Add("file", fileName)
-	params.Add("out_format", "wav")
-	err, bytes := GetBodyWithParams(robotConfig.CallBackAddr+GetRecord, params)
+	return engine.GetRecordFile(fileName)
+}
+
+func (bot *Bot) GetRecordFile(fileName string) (error, []byte) {
+	return bot.GetRecordFileContext(context.Background(), fileName)
+}
+
+func (bot *Bot) GetRecordFileContext(ctx context.Context, fileName string) (error, []byte) {
+	bytes, err := bot.callActionBody(ctx, GetRecord, map[string]string{
+		"file":       fileName,
+		"out_format": "wav",
+	})
 	if err != nil {
 		log.Println("获取bot信息异常", err.Error())
 		return err, nil
@@ -234,10 +339,48 @@ func GetRecordFile(fileName string) (error, []byte) {
 }
 
 func SendToGroup(id int64, message *MessageChain) (*MessageCallBack, error) {
-	return send(GroupMessageEventType, id, message)
+	return engine.SendToGroup(id, message)
+}
+
+func SendToGroupContext(ctx context.Context, id int64, message *MessageChain) (*MessageCallBack, error) {
+	return engine.SendToGroupContext(ctx, id, message)
+}
+
+func (bot *Bot) SendToGroup(id int64, message *MessageChain) (*MessageCallBack, error) {
+	return bot.SendToGroupContext(context.Background(), id, message)
+}
+
+func (bot *Bot) SendToGroupContext(ctx context.Context, id int64, message *MessageChain) (*MessageCallBack, error) {
+	return bot.send(ctx, GroupMessageEventType, id, message)
+}
+
+// SendToGroupAsync 异步发送群消息
+func (bot *Bot) SendToGroupAsync(id int64, message *MessageChain) *SendFuture {
+	return bot.sendAsyncTo(context.Background(), GroupMessageEventType, id, message)
 }
 
 func SendForwardMsgToGroup(groupId int64, chain *MessageChain) (*MessageCallBack, error) {
+	return engine.SendForwardMsgToGroup(groupId, chain)
+}
+
+func SendForwardMsgToGroupContext(ctx context.Context, groupId int64, chain *MessageChain) (*MessageCallBack, error) {
+	return engine.SendForwardMsgToGroupContext(ctx, groupId, chain)
+}
+
+func (bot *Bot) SendForwardMsgToGroup(groupId int64, chain *MessageChain) (*MessageCallBack, error) {
+	return bot.SendForwardMsgToGroupContext(context.Background(), groupId, chain)
+}
+
+func (bot *Bot) SendForwardMsgToGroupContext(ctx context.Context, groupId int64, chain *MessageChain) (*MessageCallBack, error) {
+	if !bot.config.RateLimit.Enable {
+		return bot.sendForwardMsgNow(ctx, groupId, chain)
+	}
+	return bot.sendAsync(ctx, sendKey(GroupMessageEventType, groupId), func() (*MessageCallBack, error) {
+		return bot.sendForwardMsgNow(ctx, groupId, chain)
+	}).WaitContext(ctx)
+}
+
+func (bot *Bot) sendForwardMsgNow(ctx context.Context, groupId int64, chain *MessageChain) (*MessageCallBack, error) {
 	mo := struct {
 		GroupId  int64       `json:"group_id"`
 		Messages []MessageMO `json:"messages"`
@@ -246,13 +389,73 @@ func SendForwardMsgToGroup(groupId int64, chain *MessageChain) (*MessageCallBack
 		Messages: *buildMessageMO(chain),
 	}
 	back := &MessageCallBack{}
-	err := PostJson(robotConfig.CallBackAddr+SendGroupForwardMsg, mo, back)
+	err := bot.callAction(ctx, SendGroupForwardMsg, mo, back)
 	if err != nil {
 		return nil, err
 	}
+	back.bot = bot
 	return back, nil
 }
 
 func SendToPrivacy(id int64, message *MessageChain) (*MessageCallBack, error) {
-	return send(PrivacyMessageEventType, id, message)
+	return engine.SendToPrivacy(id, message)
+}
+
+func SendToPrivacyContext(ctx context.Context, id int64, message *MessageChain) (*MessageCallBack, error) {
+	return engine.SendToPrivacyContext(ctx, id, message)
+}
+
+func (bot *Bot) SendToPrivacy(id int64, message *MessageChain) (*MessageCallBack, error) {
+	return bot.SendToPrivacyContext(context.Background(), id, message)
+}
+
+func (bot *Bot) SendToPrivacyContext(ctx context.Context, id int64, message *MessageChain) (*MessageCallBack, error) {
+	return bot.send(ctx, PrivacyMessageEventType, id, message)
+}
+
+// SendToPrivacyAsync 异步发送私聊消息
+func (bot *Bot) SendToPrivacyAsync(id int64, message *MessageChain) *SendFuture {
+	return bot.sendAsyncTo(context.Background(), PrivacyMessageEventType, id, message)
+}
+
+type FriendAddRequestReq struct {
+	Flag    string `json:"flag"`
+	Approve bool   `json:"approve"`
+	Remark  string `json:"remark,omitempty"`
+}
+
+type GroupAddRequestReq struct {
+	Flag    string `json:"flag"`
+	SubType string `json:"sub_type"`
+	Approve bool   `json:"approve"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Approve 同意当前的加好友/加群请求，remark为好友备注，加群请求时忽略
+func (event *EventContext) Approve(remark string) error {
+	return event.handleRequest(true, remark)
+}
+
+// Reject 拒绝当前的加好友/加群请求，reason为拒绝理由，加好友请求时忽略
+func (event *EventContext) Reject(reason string) error {
+	return event.handleRequest(false, reason)
+}
+
+func (event *EventContext) handleRequest(approve bool, content string) error {
+	switch request := event.OriginalEvent.(type) {
+	case FriendRequestEvent:
+		req := FriendAddRequestReq{Flag: request.Flag, Approve: approve}
+		if approve {
+			req.Remark = content
+		}
+		return event.Bot.callAction(event.Context(), SetFriendAddRequest, req, nil)
+	case GroupRequestEvent:
+		req := GroupAddRequestReq{Flag: request.Flag, SubType: request.SubType, Approve: approve}
+		if !approve {
+			req.Reason = content
+		}
+		return event.Bot.callAction(event.Context(), SetGroupAddRequest, req, nil)
+	default:
+		return errors.New("当前事件不是请求事件")
+	}
 }
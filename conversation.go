@@ -0,0 +1,146 @@
+package ranni
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWaitTimeout = errors.New("等待回复超时")
+	ErrBotStopped  = errors.New("bot已停止")
+)
+
+// waiter 等待同一会话中下一条消息的handler
+type waiter struct {
+	eventType EventType
+	groupId   int64
+	userId    int64
+	filter    func(next *EventContext) bool
+	origin    *EventContext // 发起等待的上下文，收到的消息沿用其Context()
+	ch        chan *EventContext
+}
+
+// conversations 正在等待回复的handler
+type conversations struct {
+	sync.Mutex
+	waiters []*waiter
+	closed  bool
+}
+
+// WaitNext 挂起当前handler，直到同一发送人在同一会话中发来满足filter的消息（filter为nil时不限制）。
+// 该消息不再分发给其他handler；超时返回ErrWaitTimeout，bot停止时返回ErrBotStopped。
+// 开启OrderedDispatch时，调用后同一会话中的后续事件不再等待当前事件处理完毕
+func (event *EventContext) WaitNext(filter func(next *EventContext) bool, timeout time.Duration) (*EventContext, error) {
+	w := &waiter{
+		eventType: event.EventType,
+		groupId:   event.GroupId,
+		userId:    event.UserId,
+		filter:    filter,
+		origin:    event,
+		ch:        make(chan *EventContext, 1),
+	}
+	if !event.Bot.conversations.add(w) {
+		return nil, ErrBotStopped
+	}
+	// 开启OrderedDispatch时不再占用会话，否则同一群中其他人的消息要等到本次等待结束
+	event.releaseSubject()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case next, ok := <-w.ch:
+		if !ok {
+			return nil, ErrBotStopped
+		}
+		return next, nil
+	case <-timer.C:
+		err = ErrWaitTimeout
+	case <-event.Context().Done():
+		err = event.Context().Err()
+	}
+	if !event.Bot.conversations.remove(w) {
+		// 超时的同时消息已经送达
+		if next, ok := <-w.ch; ok {
+			return next, nil
+		}
+		return nil, ErrBotStopped
+	}
+	return nil, err
+}
+
+// Ask 发送提问后等待同一发送人的回复
+func (event *EventContext) Ask(message *MessageChain, timeout time.Duration) (*EventContext, error) {
+	if _, err := event.Send(message); err != nil {
+		return nil, err
+	}
+	return event.WaitNext(nil, timeout)
+}
+
+func (conversations *conversations) add(w *waiter) bool {
+	conversations.Lock()
+	defer conversations.Unlock()
+	if conversations.closed {
+		return false
+	}
+	conversations.waiters = append(conversations.waiters, w)
+	return true
+}
+
+// remove 移除等待，已被投递或关闭时返回false
+func (conversations *conversations) remove(w *waiter) bool {
+	conversations.Lock()
+	defer conversations.Unlock()
+	for i, item := range conversations.waiters {
+		if item == w {
+			conversations.waiters = append(conversations.waiters[:i], conversations.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// closeAll 停止时结束所有等待
+func (conversations *conversations) closeAll() {
+	conversations.Lock()
+	defer conversations.Unlock()
+	conversations.closed = true
+	for _, w := range conversations.waiters {
+		close(w.ch)
+	}
+	conversations.waiters = nil
+}
+
+// intercept 将消息交给最早开始等待且匹配的handler，返回true时不再分发
+func (conversations *conversations) intercept(context *EventContext) bool {
+	if context.EventType != GroupMessageEventType && context.EventType != PrivacyMessageEventType {
+		return false
+	}
+	conversations.Lock()
+	defer conversations.Unlock()
+	for i, w := range conversations.waiters {
+		if w.eventType != context.EventType || w.groupId != context.GroupId || w.userId != context.UserId {
+			continue
+		}
+		if w.filter != nil && !safeFilter(w.filter, context) {
+			continue
+		}
+		conversations.waiters = append(conversations.waiters[:i], conversations.waiters[i+1:]...)
+		context.cancel()
+		context.ctx, context.cancel = w.origin.ctx, w.origin.cancel
+		w.ch <- context
+		return true
+	}
+	return false
+}
+
+func safeFilter(filter func(next *EventContext) bool, context *EventContext) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("WaitNext filter panic：", r)
+			ok = false
+		}
+	}()
+	return filter(context)
+}
@@ -0,0 +1,66 @@
+package ranni
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventContext_WaitNext(t *testing.T) {
+	// 开启OrderedDispatch时，等待回复期间同一群中其他人的消息不必排队
+	for _, config := range []*Config{{}, {OrderedDispatch: true}, {OrderedDispatch: true, WorkerPool: WorkerPoolConfig{Enable: true}}} {
+		bot := New(config)
+		var calls int32
+		answer := make(chan string, 1)
+		// 收到"start"后等待同一用户的下一条消息
+		bot.Register(funcHandler{do: func(ctx *EventContext) {
+			atomic.AddInt32(&calls, 1)
+			if ctx.MessageChain.String() != "start" {
+				return
+			}
+			next, err := ctx.WaitNext(func(next *EventContext) bool {
+				return next.MessageChain.String() != "ignored"
+			}, time.Second)
+			if err != nil {
+				answer <- err.Error()
+				return
+			}
+			answer <- next.MessageChain.String()
+		}})
+		message := func(userId int64, text string) GroupMessageEvent {
+			event := GroupMessageEvent{GroupId: 1}
+			event.Sender.UserId = userId
+			event.MessageChain = *NewMsgChain().AddText(text)
+			return event
+		}
+		bot.CallEvent(message(1, "start"))
+		deadline := time.Now().Add(time.Second)
+		for !bot.waiting() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		_, wg := bot.dispatch(message(2, "other user"))
+		wg.Wait()
+		_, wg = bot.dispatch(message(1, "ignored"))
+		wg.Wait()
+		bot.CallEvent(message(1, "42"))
+		select {
+		case answer := <-answer:
+			if answer != "42" {
+				t.Errorf("ordered=%v answer = %q", config.OrderedDispatch, answer)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("WaitNext did not return")
+		}
+		// start、other user、ignored正常分发，42被拦截
+		if calls := atomic.LoadInt32(&calls); calls != 3 {
+			t.Errorf("ordered=%v handler called %d times, want 3", config.OrderedDispatch, calls)
+		}
+	}
+}
+
+// waiting 是否有handler正在等待回复
+func (bot *Bot) waiting() bool {
+	bot.conversations.Lock()
+	defer bot.conversations.Unlock()
+	return len(bot.conversations.waiters) > 0
+}
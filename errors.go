@@ -0,0 +1,69 @@
+package ranni
+
+import (
+	"fmt"
+	json "github.com/json-iterator/go"
+)
+
+// APIError 调用OneBot action失败时返回的错误
+type APIError struct {
+	Action     string // action名称
+	HTTPStatus int    // http状态码，非http调用或请求成功时为0
+	RetCode    int    // 返回码
+	Status     string // 状态，失败时为failed
+	Wording    string // 错误说明
+
+	retCodes []int // 作为哨兵错误时匹配的返回码
+}
+
+func (err *APIError) Error() string {
+	if err.HTTPStatus != 0 {
+		return fmt.Sprintf("调用%s失败，http状态码：%d %s", err.Action, err.HTTPStatus, err.Wording)
+	}
+	return fmt.Sprintf("调用%s失败，retcode：%d %s", err.Action, err.RetCode, err.Wording)
+}
+
+// Is 与哨兵错误比较时按返回码或http状态码匹配
+func (err *APIError) Is(target error) bool {
+	sentinel, ok := target.(*APIError)
+	if !ok || sentinel.retCodes == nil {
+		return err == target
+	}
+	if sentinel.HTTPStatus != 0 && sentinel.HTTPStatus == err.HTTPStatus {
+		return true
+	}
+	for _, code := range sentinel.retCodes {
+		if code == err.RetCode {
+			return true
+		}
+	}
+	return false
+}
+
+// 常见错误，可通过errors.Is判断，同时兼容OneBot 11与12的返回码
+var (
+	ErrBadRequest   = &APIError{HTTPStatus: 400, retCodes: []int{1400, 10001, 10003, 10004}, Wording: "请求参数错误"}
+	ErrUnauthorized = &APIError{HTTPStatus: 401, retCodes: []int{1401}, Wording: "未提供access token"}
+	ErrForbidden    = &APIError{HTTPStatus: 403, retCodes: []int{1403}, Wording: "access token错误"}
+	ErrNotFound     = &APIError{HTTPStatus: 404, retCodes: []int{1404, 10002}, Wording: "不支持的action"}
+	ErrFailed       = &APIError{retCodes: []int{100, 102, 103, 201}, Wording: "操作失败"}
+)
+
+// checkResponse 检查action响应的status与retcode，成功或已提交异步处理时返回nil
+func checkResponse(action string, body []byte) error {
+	status := json.Get(body, "status").ToString()
+	retCode := json.Get(body, "retcode").ToInt()
+	if status != "failed" && (retCode == 0 || retCode == 1) {
+		return nil
+	}
+	wording := json.Get(body, "wording").ToString()
+	if wording == "" {
+		wording = json.Get(body, "msg").ToString()
+	}
+	return &APIError{
+		Action:  action,
+		RetCode: retCode,
+		Status:  status,
+		Wording: wording,
+	}
+}
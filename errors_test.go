@@ -0,0 +1,36 @@
+package ranni
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "send_msg":
+			_, _ = w.Write([]byte(`{"status":"failed","retcode":100,"wording":"消息发送失败","data":null}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	bot := New(&Config{CallBackAddr: server.URL})
+
+	_, err := bot.SendToGroup(1, NewMsgChain().AddText("hi"))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Action != "send_msg" || apiErr.Wording != "消息发送失败" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !errors.Is(err, ErrFailed) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("sentinel mismatch for %v", err)
+	}
+
+	_, err = bot.FetchBotInfo()
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Action != "get_login_info" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -5,6 +5,22 @@ type EventType int
 const (
 	GroupMessageEventType EventType = iota
 	PrivacyMessageEventType
+	GroupUploadNoticeEventType
+	GroupAdminNoticeEventType
+	GroupDecreaseNoticeEventType
+	GroupIncreaseNoticeEventType
+	GroupBanNoticeEventType
+	FriendAddNoticeEventType
+	GroupRecallNoticeEventType
+	FriendRecallNoticeEventType
+	PokeNoticeEventType
+	LuckyKingNoticeEventType
+	HonorNoticeEventType
+	FriendRequestEventType
+	GroupRequestEventType
+	LifecycleMetaEventType
+	HeartbeatMetaEventType
+	StatusUpdateMetaEventType
 )
 
 func (event EventType) String() string {
@@ -13,6 +29,38 @@ func (event EventType) String() string {
 		return "group"
 	case PrivacyMessageEventType:
 		return "private"
+	case GroupUploadNoticeEventType:
+		return "group_upload"
+	case GroupAdminNoticeEventType:
+		return "group_admin"
+	case GroupDecreaseNoticeEventType:
+		return "group_decrease"
+	case GroupIncreaseNoticeEventType:
+		return "group_increase"
+	case GroupBanNoticeEventType:
+		return "group_ban"
+	case FriendAddNoticeEventType:
+		return "friend_add"
+	case GroupRecallNoticeEventType:
+		return "group_recall"
+	case FriendRecallNoticeEventType:
+		return "friend_recall"
+	case PokeNoticeEventType:
+		return "poke"
+	case LuckyKingNoticeEventType:
+		return "lucky_king"
+	case HonorNoticeEventType:
+		return "honor"
+	case FriendRequestEventType:
+		return "friend_request"
+	case GroupRequestEventType:
+		return "group_request"
+	case LifecycleMetaEventType:
+		return "lifecycle"
+	case HeartbeatMetaEventType:
+		return "heartbeat"
+	case StatusUpdateMetaEventType:
+		return "status_update"
 	}
 	panic("unknown eventType")
 }
@@ -25,6 +73,7 @@ type BaseEvent struct {
 	Time     int64  `json:"time"`
 	SelfId   int64  `json:"self_id"`
 	PostType string `json:"post_type"`
+	Platform string `json:"platform"` // 仅OneBot 12
 }
 
 type MessageEvent struct {
@@ -72,4 +121,251 @@ type Sender struct {
 	NickName string `json:"nickname"`
 	Sex      string `json:"sex"`
 	Age      int32  `json:"age"`
+	Card     string `json:"card"`  // 群名片，仅群消息
+	Area     string `json:"area"`  // 地区，仅群消息
+	Level    string `json:"level"` // 成员等级，仅群消息
+	Role     string `json:"role"`  // owner、admin或member，仅群消息
+	Title    string `json:"title"` // 专属头衔，仅群消息
+}
+
+type NoticeEvent struct {
+	BaseEvent
+	NoticeType string `json:"notice_type"`
+	SubType    string `json:"sub_type"`
+}
+
+// GroupFile 群文件信息
+type GroupFile struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	BusId int64  `json:"busid"`
+}
+
+// GroupUploadNoticeEvent 群文件上传
+type GroupUploadNoticeEvent struct {
+	NoticeEvent
+	GroupId int64     `json:"group_id"`
+	UserId  int64     `json:"user_id"`
+	File    GroupFile `json:"file"`
+}
+
+func (GroupUploadNoticeEvent) EventType() EventType {
+	return GroupUploadNoticeEventType
+}
+
+// GroupAdminNoticeEvent 群管理员变动，SubType为set或unset
+type GroupAdminNoticeEvent struct {
+	NoticeEvent
+	GroupId int64 `json:"group_id"`
+	UserId  int64 `json:"user_id"`
+}
+
+func (GroupAdminNoticeEvent) EventType() EventType {
+	return GroupAdminNoticeEventType
+}
+
+// GroupDecreaseNoticeEvent 群成员减少，SubType为leave、kick或kick_me
+type GroupDecreaseNoticeEvent struct {
+	NoticeEvent
+	GroupId    int64 `json:"group_id"`
+	OperatorId int64 `json:"operator_id"`
+	UserId     int64 `json:"user_id"`
+}
+
+func (GroupDecreaseNoticeEvent) EventType() EventType {
+	return GroupDecreaseNoticeEventType
+}
+
+// GroupIncreaseNoticeEvent 群成员增加，SubType为approve或invite
+type GroupIncreaseNoticeEvent struct {
+	NoticeEvent
+	GroupId    int64 `json:"group_id"`
+	OperatorId int64 `json:"operator_id"`
+	UserId     int64 `json:"user_id"`
+}
+
+func (GroupIncreaseNoticeEvent) EventType() EventType {
+	return GroupIncreaseNoticeEventType
+}
+
+// GroupBanNoticeEvent 群禁言，SubType为ban或lift_ban，Duration单位为秒
+type GroupBanNoticeEvent struct {
+	NoticeEvent
+	GroupId    int64 `json:"group_id"`
+	OperatorId int64 `json:"operator_id"`
+	UserId     int64 `json:"user_id"`
+	Duration   int64 `json:"duration"`
+}
+
+func (GroupBanNoticeEvent) EventType() EventType {
+	return GroupBanNoticeEventType
+}
+
+// FriendAddNoticeEvent 好友添加
+type FriendAddNoticeEvent struct {
+	NoticeEvent
+	UserId int64 `json:"user_id"`
+}
+
+func (FriendAddNoticeEvent) EventType() EventType {
+	return FriendAddNoticeEventType
+}
+
+// GroupRecallNoticeEvent 群消息撤回
+type GroupRecallNoticeEvent struct {
+	NoticeEvent
+	GroupId    int64 `json:"group_id"`
+	UserId     int64 `json:"user_id"`
+	OperatorId int64 `json:"operator_id"`
+	MessageId  int32 `json:"message_id"`
+}
+
+func (GroupRecallNoticeEvent) EventType() EventType {
+	return GroupRecallNoticeEventType
+}
+
+// FriendRecallNoticeEvent 好友消息撤回
+type FriendRecallNoticeEvent struct {
+	NoticeEvent
+	UserId    int64 `json:"user_id"`
+	MessageId int32 `json:"message_id"`
+}
+
+func (FriendRecallNoticeEvent) EventType() EventType {
+	return FriendRecallNoticeEventType
+}
+
+// PokeNoticeEvent 戳一戳，私聊戳一戳时GroupId为0
+type PokeNoticeEvent struct {
+	NoticeEvent
+	GroupId  int64 `json:"group_id"`
+	UserId   int64 `json:"user_id"`
+	TargetId int64 `json:"target_id"`
+}
+
+func (PokeNoticeEvent) EventType() EventType {
+	return PokeNoticeEventType
+}
+
+// LuckyKingNoticeEvent 群红包运气王，UserId为红包发送者，TargetId为运气王
+type LuckyKingNoticeEvent struct {
+	NoticeEvent
+	GroupId  int64 `json:"group_id"`
+	UserId   int64 `json:"user_id"`
+	TargetId int64 `json:"target_id"`
+}
+
+func (LuckyKingNoticeEvent) EventType() EventType {
+	return LuckyKingNoticeEventType
+}
+
+// HonorNoticeEvent 群成员荣誉变更，HonorType为talkative、performer或emotion
+type HonorNoticeEvent struct {
+	NoticeEvent
+	GroupId   int64  `json:"group_id"`
+	UserId    int64  `json:"user_id"`
+	HonorType string `json:"honor_type"`
+}
+
+func (HonorNoticeEvent) EventType() EventType {
+	return HonorNoticeEventType
+}
+
+type RequestEvent struct {
+	BaseEvent
+	RequestType string `json:"request_type"`
+	UserId      int64  `json:"user_id"`
+	Comment     string `json:"comment"` // 验证信息
+	Flag        string `json:"flag"`    // 处理请求时需要传入
+}
+
+// FriendRequestEvent 加好友请求
+type FriendRequestEvent struct {
+	RequestEvent
+}
+
+func (FriendRequestEvent) EventType() EventType {
+	return FriendRequestEventType
+}
+
+// GroupRequestEvent 加群请求或邀请bot入群，SubType为add或invite
+type GroupRequestEvent struct {
+	RequestEvent
+	SubType string `json:"sub_type"`
+	GroupId int64  `json:"group_id"`
+}
+
+func (GroupRequestEvent) EventType() EventType {
+	return GroupRequestEventType
+}
+
+type MetaEvent struct {
+	BaseEvent
+	MetaEventType string `json:"meta_event_type"`
+}
+
+// LifecycleMetaEvent 生命周期，SubType为enable、disable或connect
+type LifecycleMetaEvent struct {
+	MetaEvent
+	SubType string `json:"sub_type"`
+}
+
+func (LifecycleMetaEvent) EventType() EventType {
+	return LifecycleMetaEventType
+}
+
+// HeartbeatMetaEvent 心跳，Interval为到下次心跳的间隔，单位毫秒
+type HeartbeatMetaEvent struct {
+	MetaEvent
+	Status   HeartbeatStatus `json:"status"`
+	Interval int64           `json:"interval"`
+}
+
+func (HeartbeatMetaEvent) EventType() EventType {
+	return HeartbeatMetaEventType
+}
+
+// HeartbeatStatus 心跳中携带的运行状态
+type HeartbeatStatus struct {
+	AppInitialized bool          `json:"app_initialized"`
+	AppEnabled     bool          `json:"app_enabled"`
+	AppGood        bool          `json:"app_good"`
+	Online         bool          `json:"online"` // 账号是否在线
+	Good           bool          `json:"good"`   // 运行状态是否正常
+	Stat           HeartbeatStat `json:"stat"`
+}
+
+// HeartbeatStat 统计信息
+type HeartbeatStat struct {
+	PacketReceived  uint64 `json:"packet_received"`
+	PacketSent      uint64 `json:"packet_sent"`
+	PacketLost      uint64 `json:"packet_lost"`
+	MessageReceived uint64 `json:"message_received"`
+	MessageSent     uint64 `json:"message_sent"`
+	DisconnectTimes uint32 `json:"disconnect_times"`
+	LostTimes       uint32 `json:"lost_times"`
+	LastMessageTime int64  `json:"last_message_time"`
+}
+
+// StatusUpdateMetaEvent 状态更新，仅OneBot 12
+type StatusUpdateMetaEvent struct {
+	MetaEvent
+	Status struct {
+		Good bool        `json:"good"`
+		Bots []BotStatus `json:"bots"`
+	} `json:"status"`
+}
+
+func (StatusUpdateMetaEvent) EventType() EventType {
+	return StatusUpdateMetaEventType
+}
+
+// BotStatus OneBot 12中单个机器人账号的状态
+type BotStatus struct {
+	Self struct {
+		Platform string `json:"platform"`
+		UserId   int64  `json:"user_id"`
+	} `json:"self"`
+	Online bool `json:"online"`
 }
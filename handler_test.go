@@ -0,0 +1,66 @@
+package ranni
+
+import "sync/atomic"
+
+// funcHandler 测试用handler，do为空时忽略事件，filter为空时接收所有事件，id为空时使用类型名
+type funcHandler struct {
+	do       func(ctx *EventContext)
+	filter   func(ctx *EventContext) bool
+	help     string
+	id       string
+	priority int
+}
+
+func (handler funcHandler) Do(ctx *EventContext) {
+	if handler.do != nil {
+		handler.do(ctx)
+	}
+}
+
+func (handler funcHandler) Filter(ctx *EventContext) bool {
+	return handler.filter == nil || handler.filter(ctx)
+}
+
+func (handler funcHandler) Help() string {
+	return handler.help
+}
+
+func (handler funcHandler) ID() string {
+	return handler.id
+}
+
+func (handler funcHandler) Priority() int {
+	return handler.priority
+}
+
+// limitedHandler 指定并发上限的funcHandler
+type limitedHandler struct {
+	funcHandler
+	limit int
+}
+
+func (handler limitedHandler) MaxConcurrency() int {
+	return handler.limit
+}
+
+// lifecycleHandler 带Init、Shutdown的funcHandler
+type lifecycleHandler struct {
+	funcHandler
+	init     func(bot *Bot) error
+	shutdown func()
+}
+
+func (handler lifecycleHandler) Init(bot *Bot) error {
+	return handler.init(bot)
+}
+
+func (handler lifecycleHandler) Shutdown() {
+	handler.shutdown()
+}
+
+// counting 记录调用次数的handler
+func counting(calls *int32) funcHandler {
+	return funcHandler{do: func(ctx *EventContext) {
+		atomic.AddInt32(calls, 1)
+	}}
+}
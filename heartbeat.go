@@ -0,0 +1,125 @@
+package ranni
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// HeartbeatTimeoutHandler 心跳超时回调，last为最后一次收到的心跳
+type HeartbeatTimeoutHandler func(last HeartbeatMetaEvent)
+
+// heartbeatWatchdog 记录最后一次心跳，超过约定间隔未收到心跳时触发超时
+type heartbeatWatchdog struct {
+	sync.Mutex
+	last     HeartbeatMetaEvent
+	received bool
+	lastAt   time.Time
+	stopped  bool
+	timer    *time.Timer
+	handlers []HeartbeatTimeoutHandler
+}
+
+func (bot *Bot) onHeartbeat(event HeartbeatMetaEvent) {
+	watchdog := &bot.heartbeat
+	watchdog.Lock()
+	defer watchdog.Unlock()
+	if watchdog.stopped {
+		return
+	}
+	if watchdog.received && watchdog.last.Status.Online && !event.Status.Online {
+		log.Printf("bot %d 已离线", event.SelfId)
+	}
+	if bot.config.ProtocolVersion == OneBot12 {
+		// v12的心跳不携带状态，状态由status_update更新
+		event.Status = watchdog.last.Status
+	}
+	watchdog.last = event
+	watchdog.received = true
+	watchdog.lastAt = time.Now()
+	timeout := bot.config.HeartbeatTimeout
+	if timeout <= 0 {
+		if event.Interval <= 0 {
+			return
+		}
+		timeout = 2 * time.Duration(event.Interval) * time.Millisecond
+	}
+	if watchdog.timer == nil {
+		watchdog.timer = time.AfterFunc(timeout, bot.heartbeatTimeout)
+	} else {
+		watchdog.timer.Reset(timeout)
+	}
+}
+
+// onStatusUpdate 使用OneBot 12的status_update更新最后一次心跳中的状态
+func (bot *Bot) onStatusUpdate(event StatusUpdateMetaEvent) {
+	watchdog := &bot.heartbeat
+	watchdog.Lock()
+	defer watchdog.Unlock()
+	watchdog.last.Status.Good = event.Status.Good
+	for _, status := range event.Status.Bots {
+		if watchdog.last.SelfId == 0 || status.Self.UserId == watchdog.last.SelfId {
+			watchdog.last.Status.Online = status.Online
+			break
+		}
+	}
+}
+
+func (bot *Bot) heartbeatTimeout() {
+	watchdog := &bot.heartbeat
+	watchdog.Lock()
+	last := watchdog.last
+	lastAt := watchdog.lastAt
+	handlers := watchdog.handlers
+	watchdog.Unlock()
+	log.Printf("超过%v未收到心跳", time.Since(lastAt).Round(time.Millisecond))
+	for _, handler := range handlers {
+		handler(last)
+	}
+	if bot.config.HeartbeatReconnect {
+		bot.dropConnections()
+	}
+}
+
+func (bot *Bot) stopHeartbeatWatchdog() {
+	watchdog := &bot.heartbeat
+	watchdog.Lock()
+	defer watchdog.Unlock()
+	watchdog.stopped = true
+	if watchdog.timer != nil {
+		watchdog.timer.Stop()
+	}
+}
+
+// dropConnections 断开当前的ws连接，正向ws将自动重连，反向ws等待OneBot实现重新连接
+func (bot *Bot) dropConnections() {
+	bot.wsActions.writeLock.Lock()
+	conn := bot.wsActions.conn
+	bot.wsActions.writeLock.Unlock()
+	if conn != nil && !bot.config.ReverseWs {
+		_ = conn.Close()
+	}
+	bot.reverseConns.closeAll()
+}
+
+// LastHeartbeat 返回最后一次收到的心跳，尚未收到心跳时ok为false
+func (bot *Bot) LastHeartbeat() (heartbeat HeartbeatMetaEvent, ok bool) {
+	bot.heartbeat.Lock()
+	defer bot.heartbeat.Unlock()
+	return bot.heartbeat.last, bot.heartbeat.received
+}
+
+// OnHeartbeatTimeout 注册心跳超时回调
+func (bot *Bot) OnHeartbeatTimeout(handler HeartbeatTimeoutHandler) {
+	bot.heartbeat.Lock()
+	defer bot.heartbeat.Unlock()
+	bot.heartbeat.handlers = append(bot.heartbeat.handlers, handler)
+}
+
+func LastHeartbeat() (HeartbeatMetaEvent, bool) {
+	return engine.LastHeartbeat()
+}
+
+func OnHeartbeatTimeout(handler HeartbeatTimeoutHandler) {
+	engine.OnHeartbeatTimeout(handler)
+}
@@ -0,0 +1,142 @@
+package ranni
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHttpPostPath   = "/onebot/v11/http"
+	quickOperationTimeout = 5 * time.Second // 等待handler给出快速操作的最长时间
+)
+
+func (bot *Bot) httpPostHandler(ctx *gin.Context) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		log.Println("读取http post事件失败：", err)
+		ctx.Status(http.StatusBadRequest)
+		return
+	}
+	if !bot.checkSignature(body, ctx.GetHeader("X-Signature")) {
+		NoAuth(ctx, "签名校验失败")
+		return
+	}
+	event, err := bot.decodeEvent(body)
+	if err != nil {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+	context, wg := bot.dispatch(event)
+	waitTimeout(wg, quickOperationTimeout)
+	if operation := context.takeQuickOperation(); len(operation) > 0 {
+		ctx.JSON(http.StatusOK, operation)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// checkSignature 校验X-Signature，格式为sha1=HMAC-SHA1(secret, body)的十六进制
+func (bot *Bot) checkSignature(body []byte, signature string) bool {
+	if bot.config.Secret == "" {
+		return true
+	}
+	if !strings.HasPrefix(signature, "sha1=") {
+		return false
+	}
+	expect, err := hex.DecodeString(strings.TrimPrefix(signature, "sha1="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(bot.config.Secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expect)
+}
+
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// QuickReply 快速回复当前消息，仅在http post模式下生效
+func (event *EventContext) QuickReply(message *MessageChain, atSender bool) {
+	event.setQuickOperation("reply", *buildMessageMO(message))
+	event.setQuickOperation("at_sender", atSender)
+}
+
+// QuickDelete 快速撤回当前群消息，仅在http post模式下生效
+func (event *EventContext) QuickDelete() {
+	event.setQuickOperation("delete", true)
+}
+
+// QuickKick 快速把发送者踢出群，仅在http post模式下生效
+func (event *EventContext) QuickKick() {
+	event.setQuickOperation("kick", true)
+}
+
+// QuickBan 快速禁言发送者，仅在http post模式下生效
+func (event *EventContext) QuickBan(duration time.Duration) {
+	event.setQuickOperation("ban", true)
+	event.setQuickOperation("ban_duration", int64(duration/time.Second))
+}
+
+// QuickApprove 快速同意加好友/加群请求，remark为好友备注，仅在http post模式下生效
+func (event *EventContext) QuickApprove(remark string) {
+	event.setQuickOperation("approve", true)
+	if remark != "" {
+		event.setQuickOperation("remark", remark)
+	}
+}
+
+// QuickReject 快速拒绝加好友/加群请求，reason为拒绝理由，仅在http post模式下生效
+func (event *EventContext) QuickReject(reason string) {
+	event.setQuickOperation("approve", false)
+	if reason != "" {
+		event.setQuickOperation("reason", reason)
+	}
+}
+
+// quickOperation 同一事件的各handler共享的快速操作
+type quickOperation struct {
+	lock      sync.Mutex
+	operation map[string]interface{}
+}
+
+func (event *EventContext) setQuickOperation(key string, value interface{}) {
+	if event.quick == nil {
+		return
+	}
+	event.quick.lock.Lock()
+	defer event.quick.lock.Unlock()
+	if event.quick.operation == nil {
+		event.quick.operation = make(map[string]interface{})
+	}
+	event.quick.operation[key] = value
+}
+
+func (event *EventContext) takeQuickOperation() map[string]interface{} {
+	if event.quick == nil {
+		return nil
+	}
+	event.quick.lock.Lock()
+	defer event.quick.lock.Unlock()
+	operation := event.quick.operation
+	event.quick.operation = nil
+	return operation
+}
@@ -0,0 +1,59 @@
+package ranni
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	json "github.com/json-iterator/go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const groupMessageFrame = `{"time":1,"self_id":10001,"post_type":"message","message_type":"group","sub_type":"normal",` +
+	`"message_id":1,"group_id":123,"user_id":456,"message":[{"type":"text","data":{"text":"ping"}}],` +
+	`"raw_message":"ping","font":0,"sender":{"user_id":456,"nickname":"lain"}}`
+
+func Test_httpPostHandler(t *testing.T) {
+	bot := New(&Config{Secret: "secret"})
+	bot.Register(funcHandler{
+		do: func(ctx *EventContext) {
+			ctx.QuickReply(NewMsgChain().AddText("pong"), true)
+		},
+		filter: func(ctx *EventContext) bool {
+			return ctx.MessageChain.String() == "ping"
+		},
+		help: "ping",
+	})
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.POST("/", bot.httpPostHandler)
+
+	body := []byte(groupMessageFrame)
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha1=" + hex.EncodeToString(mac.Sum(nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("X-Signature", "sha1=0000")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("bad signature: expect 401, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("X-Signature", signature)
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", w.Code)
+	}
+	resp := w.Body.Bytes()
+	if json.Get(resp, "reply", 0, "data", "text").ToString() != "pong" || !json.Get(resp, "at_sender").ToBool() {
+		t.Fatalf("unexpected quick operation: %s", resp)
+	}
+}
@@ -2,91 +2,127 @@ package ranni
 
 import (
 	"bytes"
+	"context"
 	"github.com/gin-gonic/gin"
 	json "github.com/json-iterator/go"
 	"io"
 	"net/http"
 	urls "net/url"
+	"path"
+	"strings"
 	"time"
 )
 
 var client = &http.Client{Timeout: 30 * time.Second}
 
 func PostJson(url string, body interface{}, respStruct interface{}) error {
-	marshal, _ := json.Marshal(body)
-	u, _ := urls.Parse(url)
-	values := u.Query()
-	values.Add("access_token", robotConfig.AccessToken)
-	u.RawQuery = values.Encode()
-	resp, err := client.Post(u.String(), "application/json", bytes.NewBuffer(marshal))
-	if err == nil && resp.StatusCode == 200 {
-		defer resp.Body.Close()
-		if respStruct == nil {
-			return nil
-		}
-		all, err2 := io.ReadAll(resp.Body)
-		if err2 != nil {
-			return err2
-		}
-		err := json.Unmarshal(all, respStruct)
-		if err != nil {
-			return err
-		}
-		return nil
-	} else {
+	return PostJsonContext(context.Background(), url, body, respStruct)
+}
+
+func PostJsonContext(ctx context.Context, url string, body interface{}, respStruct interface{}) error {
+	all, err := engine.postJsonBody(ctx, url, body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(actionOf(url), all); err != nil {
 		return err
 	}
+	if respStruct == nil {
+		return nil
+	}
+	return json.Unmarshal(all, respStruct)
+}
+
+func (bot *Bot) postJsonBody(ctx context.Context, url string, body interface{}) ([]byte, error) {
+	httpClient, _, err := bot.network()
+	if err != nil {
+		return nil, err
+	}
+	marshal, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(marshal))
+	if err != nil {
+		return nil, err
+	}
+	bot.config.authorize(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	return readResponse(url, resp, err)
 }
 
 func GetWithParams(url string, params urls.Values, respStruct interface{}, path ...interface{}) error {
-	parse, err := urls.Parse(url)
+	return GetWithParamsContext(context.Background(), url, params, respStruct, path...)
+}
+
+func GetWithParamsContext(ctx context.Context, url string, params urls.Values, respStruct interface{}, path ...interface{}) error {
+	err, all := GetBodyWithParamsContext(ctx, url, params)
 	if err != nil {
 		return err
 	}
-	params.Add("access_token", robotConfig.AccessToken)
-	parse.RawQuery = params.Encode()
-	urlWithParams := parse.String()
-	resp, err := client.Get(urlWithParams)
-	if err == nil && resp.StatusCode == 200 {
-		defer resp.Body.Close()
-		if respStruct == nil {
-			return nil
-		}
-		all, err2 := io.ReadAll(resp.Body)
-		if err2 != nil {
-			return err2
-		}
-		json.Get(all, path...).ToVal(respStruct)
+	if respStruct == nil {
 		return nil
-	} else {
-		return err
 	}
-
+	json.Get(all, path...).ToVal(respStruct)
+	return nil
 }
 
 func GetBodyWithParams(url string, params urls.Values) (error, []byte) {
-	if params == nil {
-		params = urls.Values{}
+	return GetBodyWithParamsContext(context.Background(), url, params)
+}
+
+func GetBodyWithParamsContext(ctx context.Context, url string, params urls.Values) (error, []byte) {
+	httpClient, _, err := engine.network()
+	if err != nil {
+		return err, nil
 	}
 	parse, err := urls.Parse(url)
 	if err != nil {
 		return err, nil
 	}
-	params.Add("access_token", robotConfig.AccessToken)
 	parse.RawQuery = params.Encode()
-	urlWithParams := parse.String()
-	resp, err := client.Get(urlWithParams)
-	if err == nil && resp.StatusCode == 200 {
-		defer resp.Body.Close()
-		all, err2 := io.ReadAll(resp.Body)
-		if err2 != nil {
-			return err2, nil
-		}
-		return nil, all
-	} else {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parse.String(), nil)
+	if err != nil {
+		return err, nil
+	}
+	engine.config.authorize(req)
+	resp, err := httpClient.Do(req)
+	all, err := readResponse(url, resp, err)
+	if err != nil {
 		return err, nil
 	}
+	if err := checkResponse(actionOf(url), all); err != nil {
+		return err, nil
+	}
+	return nil, all
+}
 
+// readResponse 读取响应内容，状态码非200时返回APIError
+func readResponse(url string, resp *http.Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	all, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{
+			Action:     actionOf(url),
+			HTTPStatus: resp.StatusCode,
+			Status:     "failed",
+			Wording:    strings.TrimSpace(string(all)),
+		}
+	}
+	return all, err
+}
+
+// actionOf 从接口地址中取出action名称
+func actionOf(url string) string {
+	u, err := urls.Parse(url)
+	if err != nil {
+		return url
+	}
+	return path.Base(u.Path)
 }
 
 type Result struct {
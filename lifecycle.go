@@ -0,0 +1,150 @@
+package ranni
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// InitHandler 可选接口，bot首次连接成功后调用（http post模式下为开始监听时），在此之前或初始化失败时handler不会收到事件；
+// 连接后注册的handler会立即初始化
+type InitHandler interface {
+	Init(bot *Bot) error
+}
+
+// ShutdownHandler 可选接口，handler被注销或bot停止时，在该handler执行中的事件全部结束后调用
+type ShutdownHandler interface {
+	Shutdown()
+}
+
+func Unregister(id string) error {
+	return engine.Unregister(id)
+}
+
+// Unregister 注销handler，不再向其分发新事件；Shutdown在执行中的事件结束后异步调用
+func (bot *Bot) Unregister(id string) error {
+	bot.listenersLock.Lock()
+	var removed *registeredHandler
+	for i, registered := range bot.innerListeners {
+		if registered.id == id {
+			removed = registered
+			bot.innerListeners = append(bot.innerListeners[:i:i], bot.innerListeners[i+1:]...)
+			break
+		}
+	}
+	if removed != nil {
+		bot.refreshHelp()
+	}
+	bot.listenersLock.Unlock()
+	if removed == nil {
+		return fmt.Errorf("handler %s 不存在", id)
+	}
+	go bot.shutdownHandler(removed)
+	return nil
+}
+
+// listeners 返回当前注册的handler快照
+func (bot *Bot) listeners() []*registeredHandler {
+	bot.listenersLock.RLock()
+	defer bot.listenersLock.RUnlock()
+	listeners := make([]*registeredHandler, len(bot.innerListeners))
+	copy(listeners, bot.innerListeners)
+	return listeners
+}
+
+// refreshHelp 根据当前的handler重新生成HelpNotice，调用方需持有listenersLock写锁
+func (bot *Bot) refreshHelp() {
+	if len(bot.innerListeners) == 0 {
+		bot.HelpNotice = ""
+		return
+	}
+	notice := "使 用 指 南\n"
+	for _, registered := range bot.innerListeners {
+		notice += "\n" + registered.help
+	}
+	bot.HelpNotice = notice
+}
+
+// initHandlers 连接成功后初始化所有handler
+func (bot *Bot) initHandlers() {
+	if !atomic.CompareAndSwapInt32(&bot.connected, 0, 1) {
+		return
+	}
+	for _, registered := range bot.listeners() {
+		go bot.initRegistered(registered)
+	}
+}
+
+func (bot *Bot) initRegistered(registered *registeredHandler) {
+	registered.lock.RLock()
+	defer registered.lock.RUnlock()
+	if !registered.removed {
+		bot.initHandler(registered)
+	}
+}
+
+// ready 返回handler能否接收事件，实现了InitHandler的handler在bot连接前不接收事件；调用方需持有registered.lock读锁
+func (bot *Bot) ready(registered *registeredHandler) bool {
+	if _, ok := registered.handler.(InitHandler); ok && atomic.LoadInt32(&bot.connected) == 0 {
+		return false
+	}
+	return bot.initHandler(registered)
+}
+
+// initHandler 初始化handler，仅执行一次，返回handler是否可用；调用方需持有registered.lock读锁
+func (bot *Bot) initHandler(registered *registeredHandler) bool {
+	registered.initOnce.Do(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				registered.initErr = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+			if registered.initErr != nil {
+				bot.reportError(nil, fmt.Errorf("handler %s 初始化失败：%w", registered.id, registered.initErr))
+				return
+			}
+			registered.initialized = true
+		}()
+		if handler, ok := registered.handler.(InitHandler); ok {
+			registered.initErr = handler.Init(bot)
+		}
+	})
+	return registered.initialized
+}
+
+// shutdownHandler 等待handler执行中的事件结束后调用Shutdown
+func (bot *Bot) shutdownHandler(registered *registeredHandler) {
+	registered.lock.Lock()
+	defer registered.lock.Unlock()
+	if registered.removed {
+		return
+	}
+	registered.removed = true
+	handler, ok := registered.handler.(ShutdownHandler)
+	if !ok || !registered.initialized {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			bot.reportError(nil, fmt.Errorf("handler %s 关闭失败：%w", registered.id, &PanicError{Value: r, Stack: debug.Stack()}))
+		}
+	}()
+	handler.Shutdown()
+}
+
+// shutdownHandlers bot停止时关闭所有handler，ctx结束时不再等待
+func (bot *Bot) shutdownHandlers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, registered := range bot.listeners() {
+			bot.shutdownHandler(registered)
+		}
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,88 @@
+package ranni
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBot_Unregister(t *testing.T) {
+	bot := New(&Config{})
+	var inits, calls int32
+	closed := make(chan struct{})
+	handler := counting(&calls)
+	handler.id, handler.help = "lifecycle", "lifecycle"
+	bot.Register(lifecycleHandler{
+		funcHandler: handler,
+		init: func(bot *Bot) error {
+			atomic.AddInt32(&inits, 1)
+			return nil
+		},
+		shutdown: func() {
+			close(closed)
+		},
+	})
+	if !strings.Contains(bot.HelpNotice, "lifecycle") {
+		t.Errorf("help notice = %q", bot.HelpNotice)
+	}
+	// 连接前不初始化，也不接收事件
+	_, wg := bot.dispatch(PrivacyMessageEvent{})
+	wg.Wait()
+	if inits != 0 || calls != 0 {
+		t.Errorf("before connected: inits = %d, calls = %d", inits, calls)
+	}
+	bot.notifyState(Connected, nil)
+	for i := 0; i < 2; i++ {
+		_, wg := bot.dispatch(PrivacyMessageEvent{})
+		wg.Wait()
+	}
+	if inits != 1 || calls != 2 {
+		t.Errorf("inits = %d, calls = %d", inits, calls)
+	}
+
+	if err := bot.Unregister("lifecycle"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.Unregister("lifecycle"); err == nil {
+		t.Error("expected error for unknown handler")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown not called")
+	}
+	_, wg = bot.dispatch(PrivacyMessageEvent{})
+	wg.Wait()
+	if calls != 2 {
+		t.Error("unregistered handler still receives events")
+	}
+	if bot.HelpNotice != "" {
+		t.Errorf("help notice = %q, want empty", bot.HelpNotice)
+	}
+}
+
+func TestBot_initOnHttpPostListen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bot := New(&Config{HttpPost: true, HttpPostAddr: "127.0.0.1:0"})
+	inits := make(chan struct{})
+	bot.Register(lifecycleHandler{
+		init: func(bot *Bot) error {
+			close(inits)
+			return nil
+		},
+		shutdown: func() {},
+	})
+	bot.startServers()
+	defer func() {
+		for _, server := range bot.servers {
+			_ = server.Close()
+		}
+	}()
+	select {
+	case <-inits:
+	case <-time.After(time.Second):
+		t.Fatal("Init not called after http post server started")
+	}
+}
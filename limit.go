@@ -0,0 +1,140 @@
+package ranni
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LimitScope 冷却及配额的统计范围
+type LimitScope int
+
+const (
+	PerUser      LimitScope = iota // 每个QQ号
+	PerGroup                       // 每个群，私聊时按QQ号统计
+	PerGroupUser                   // 每个群中的每个QQ号
+)
+
+// CooldownPolicy 同一范围内两次触发handler的最短间隔
+type CooldownPolicy struct {
+	Duration time.Duration
+	Scope    LimitScope
+	Reply    string // 冷却中触发时的回复，{remaining}会替换为剩余时间，为空时不回复
+	Persist  bool   // 为true时计数保存在bot的Store中，重启后保留；默认只保存在内存，不会每次触发都写入文件
+}
+
+// QuotaPolicy 同一范围内每天可触发handler的次数，按本地时间0点重置
+type QuotaPolicy struct {
+	Limit   int
+	Scope   LimitScope
+	Reply   string // 次数用尽时的回复，{limit}会替换为每日次数，为空时不回复
+	Persist bool   // 同CooldownPolicy.Persist
+}
+
+// Cooldown 冷却中间件，可通过Register(handler, Cooldown(...))挂载到任意handler
+func Cooldown(policy CooldownPolicy) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *EventContext) error {
+			key := "cooldown:" + ctx.HandlerId + ":" + policy.Scope.key(ctx)
+			remaining, err := ctx.Bot.takeCooldown(policy.Persist, key, policy.Duration)
+			if err != nil {
+				return err
+			}
+			if remaining > 0 {
+				if policy.Reply != "" {
+					replyText(ctx, strings.ReplaceAll(policy.Reply, "{remaining}", remaining.Round(time.Second).String()))
+				}
+				return nil
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// Quota 每日配额中间件，可通过Register(handler, Quota(...))挂载到任意handler
+func Quota(policy QuotaPolicy) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *EventContext) error {
+			key := "quota:" + ctx.HandlerId + ":" + policy.Scope.key(ctx)
+			ok, err := ctx.Bot.takeQuota(policy.Persist, key, policy.Limit, time.Now())
+			if err != nil {
+				return err
+			}
+			if !ok {
+				if policy.Reply != "" {
+					replyText(ctx, strings.ReplaceAll(policy.Reply, "{limit}", strconv.Itoa(policy.Limit)))
+				}
+				return nil
+			}
+			return next(ctx)
+		}
+	}
+}
+
+func (scope LimitScope) key(ctx *EventContext) string {
+	user := "u" + strconv.FormatInt(ctx.UserId, 10)
+	if ctx.GroupId == 0 {
+		return user
+	}
+	group := "g" + strconv.FormatInt(ctx.GroupId, 10)
+	switch scope {
+	case PerGroup:
+		return group
+	case PerGroupUser:
+		return group + ":" + user
+	default:
+		return user
+	}
+}
+
+// limitStore 冷却及配额计数使用的存储
+func (bot *Bot) limitStore(persist bool) Store {
+	if persist {
+		return bot.Store()
+	}
+	return bot.limits
+}
+
+// takeCooldown 冷却结束时开始新的冷却并返回0，否则返回剩余时间
+func (bot *Bot) takeCooldown(persist bool, key string, duration time.Duration) (time.Duration, error) {
+	bot.limitLock.Lock()
+	defer bot.limitLock.Unlock()
+	store := bot.limitStore(persist)
+	value, ok, err := store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if ok {
+		until, err := strconv.ParseInt(string(value), 10, 64)
+		if err == nil && now.UnixNano() < until {
+			return time.Duration(until - now.UnixNano()), nil
+		}
+	}
+	until := now.Add(duration).UnixNano()
+	return 0, store.Set(key, []byte(strconv.FormatInt(until, 10)), duration)
+}
+
+// takeQuota 配额未用尽时计数加一并返回true，计数以"日期:次数"保存，跨天后重新计数
+func (bot *Bot) takeQuota(persist bool, key string, limit int, now time.Time) (bool, error) {
+	bot.limitLock.Lock()
+	defer bot.limitLock.Unlock()
+	store := bot.limitStore(persist)
+	value, ok, err := store.Get(key)
+	if err != nil {
+		return false, err
+	}
+	today := now.Format("20060102")
+	used := 0
+	if ok {
+		if parts := strings.SplitN(string(value), ":", 2); len(parts) == 2 && parts[0] == today {
+			used, _ = strconv.Atoi(parts[1])
+		}
+	}
+	if used >= limit {
+		return false, nil
+	}
+	year, month, day := now.Date()
+	ttl := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Sub(now)
+	return true, store.Set(key, []byte(today+":"+strconv.Itoa(used+1)), ttl)
+}
@@ -0,0 +1,96 @@
+package ranni
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCooldownAndQuota(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	bot := New(&Config{StorePath: path})
+	var cooled, quoted int32
+	bot.Register(counting(&cooled), Cooldown(CooldownPolicy{Duration: time.Hour, Scope: PerGroup}))
+	bot.Register(counting(&quoted), Quota(QuotaPolicy{Limit: 2, Scope: PerGroupUser}))
+	message := func(groupId, userId int64) GroupMessageEvent {
+		event := GroupMessageEvent{GroupId: groupId}
+		event.Sender.UserId = userId
+		return event
+	}
+	for _, event := range []GroupMessageEvent{message(1, 1), message(1, 2), message(1, 1), message(1, 1), message(2, 1)} {
+		_, wg := bot.dispatch(event)
+		wg.Wait()
+	}
+	// 群1冷却一次，群2冷却一次
+	if cooled != 2 {
+		t.Errorf("cooldown handler called %d times, want 2", cooled)
+	}
+	// 群1用户1两次，群1用户2一次，群2用户1一次
+	if quoted != 4 {
+		t.Errorf("quota handler called %d times, want 4", quoted)
+	}
+	// 未开启Persist时计数只保存在内存
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("store file written without Persist: %v", err)
+	}
+	var persisted int32
+	handler := counting(&persisted)
+	handler.id = "persisted"
+	bot.Register(handler, Quota(QuotaPolicy{Limit: 1, Scope: PerUser, Persist: true}))
+	_, wg := bot.dispatch(message(1, 1))
+	wg.Wait()
+	restarted := New(&Config{StorePath: path})
+	if keys, _ := restarted.Store().Keys("quota:persisted:"); len(keys) != 1 {
+		t.Errorf("persisted quota keys = %v", keys)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "store.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("perm:a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("perm:b", []byte("2"), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok, _ := reopened.Get("perm:a")
+	if !ok || string(value) != "1" {
+		t.Errorf("perm:a = %q, %v", value, ok)
+	}
+	keys, _ := reopened.Keys("perm:")
+	if len(keys) != 1 {
+		t.Errorf("keys = %v, expired entry should be dropped", keys)
+	}
+}
+
+func TestMemoryStore_purge(t *testing.T) {
+	store := NewMemoryStore()
+	for i := 0; i < 100; i++ {
+		_ = store.Set("cooldown:"+strconv.Itoa(i), []byte("1"), time.Nanosecond)
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := store.Get("cooldown:0"); ok {
+		t.Error("expired entry returned")
+	}
+	// 不再读取的过期项在后续写入时被清理
+	for i := 0; i < 100; i++ {
+		_ = store.Set("quota:"+strconv.Itoa(i), []byte("1"), 0)
+	}
+	store.lock.RLock()
+	size := len(store.entries)
+	store.lock.RUnlock()
+	if size > 100 {
+		t.Errorf("%d entries kept, expired entries not purged", size)
+	}
+}
@@ -0,0 +1,66 @@
+package ranni
+
+import "sync"
+
+// HandlerFunc 执行handler的处理逻辑，返回处理过程中产生的错误
+type HandlerFunc func(ctx *EventContext) error
+
+// Middleware 包装HandlerFunc，在handler的Filter通过后执行；不调用next即可中断本次处理
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// registeredHandler 注册的handler及其专属中间件
+type registeredHandler struct {
+	id          string
+	handler     EventHandler
+	help        string
+	middlewares []Middleware
+	breaker     circuitBreaker
+	priority    int
+
+	lock        sync.RWMutex // 执行事件时持有读锁，关闭时持有写锁
+	removed     bool
+	initOnce    sync.Once
+	initErr     error
+	initialized bool
+
+	slotsOnce sync.Once
+	slots     chan struct{} // 并发上限，为nil时不限制
+	waitLock  sync.Mutex
+	waiters   []*eventRun // 开启协程池时等待空位的事件，按等待顺序排列
+}
+
+// Use 为默认bot添加对所有handler生效的中间件
+func Use(middlewares ...Middleware) {
+	engine.Use(middlewares...)
+}
+
+// Use 添加对所有handler生效的中间件，先添加的位于外层，且位于handler专属中间件的外层
+func (bot *Bot) Use(middlewares ...Middleware) {
+	bot.middlewares = append(bot.middlewares, middlewares...)
+}
+
+// chain 组装handler的中间件调用链
+func (bot *Bot) chain(registered *registeredHandler) HandlerFunc {
+	next := func(ctx *EventContext) error {
+		return recoverDo(registered.handler, ctx)
+	}
+	for i := len(registered.middlewares) - 1; i >= 0; i-- {
+		next = registered.middlewares[i](next)
+	}
+	for i := len(bot.middlewares) - 1; i >= 0; i-- {
+		next = bot.middlewares[i](next)
+	}
+	return next
+}
+
+// fork 为handler复制一份上下文，中间件对Values的修改只对该handler可见
+func (event *EventContext) fork(registered *registeredHandler) *EventContext {
+	forked := *event
+	forked.Handler = registered.handler
+	forked.HandlerId = registered.id
+	forked.Values = make(map[string]interface{}, len(event.Values))
+	for key, value := range event.Values {
+		forked.Values[key] = value
+	}
+	return &forked
+}
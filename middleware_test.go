@@ -0,0 +1,66 @@
+package ranni
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestBot_Use(t *testing.T) {
+	bot := New(&Config{})
+	lock := &sync.Mutex{}
+	var seen []interface{}
+	var outcomes []error
+	// 记录执行时Values中的user值
+	handler := funcHandler{do: func(ctx *EventContext) {
+		lock.Lock()
+		defer lock.Unlock()
+		seen = append(seen, ctx.Values["user"])
+	}}
+	bot.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *EventContext) error {
+			err := next(ctx)
+			lock.Lock()
+			outcomes = append(outcomes, err)
+			lock.Unlock()
+			return err
+		}
+	})
+	denied := errors.New("denied")
+	bot.Register(handler, func(next HandlerFunc) HandlerFunc {
+		return func(ctx *EventContext) error {
+			ctx.Values["user"] = "alice"
+			return next(ctx)
+		}
+	})
+	bot.Register(handler, func(next HandlerFunc) HandlerFunc {
+		return func(ctx *EventContext) error {
+			return denied
+		}
+	})
+	bot.Register(handler)
+	_, wg := bot.dispatch(PrivacyMessageEvent{})
+	wg.Wait()
+
+	if len(seen) != 2 {
+		t.Fatalf("handled %d times, want 2", len(seen))
+	}
+	alice := 0
+	for _, value := range seen {
+		if value == "alice" {
+			alice++
+		}
+	}
+	if alice != 1 {
+		t.Errorf("values = %v, middleware value should only reach its own handler", seen)
+	}
+	failed := 0
+	for _, err := range outcomes {
+		if errors.Is(err, denied) {
+			failed++
+		}
+	}
+	if len(outcomes) != 3 || failed != 1 {
+		t.Errorf("outcomes = %v", outcomes)
+	}
+}
@@ -0,0 +1,145 @@
+package ranni
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// network 根据TLS与代理配置创建的http客户端及ws拨号器
+type network struct {
+	lock   sync.Mutex
+	config *Config // 创建时使用的配置，配置替换后重新创建
+	client *http.Client
+	dialer *websocket.Dialer
+	err    error
+}
+
+// network 返回bot使用的http客户端与ws拨号器，首次调用时根据配置创建
+func (bot *Bot) network() (*http.Client, *websocket.Dialer, error) {
+	n := &bot.net
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.config != bot.config {
+		n.config = bot.config
+		n.client, n.dialer, n.err = newNetwork(bot.config)
+	}
+	return n.client, n.dialer, n.err
+}
+
+func newNetwork(config *Config) (*http.Client, *websocket.Dialer, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != "" {
+		proxyUrl, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, nil, err
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+	if tlsConfig == nil && config.Proxy == "" {
+		return client, websocket.DefaultDialer, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+	dialer := &websocket.Dialer{
+		Proxy:            proxy,
+		TLSClientConfig:  tlsConfig,
+		HandshakeTimeout: 45 * time.Second,
+	}
+	return &http.Client{Timeout: client.Timeout, Transport: transport}, dialer, nil
+}
+
+// tlsConfig 根据证书配置创建tls配置，未配置时返回nil使用系统默认
+func (config *Config) tlsConfig() (*tls.Config, error) {
+	if config.CACertFile == "" && config.ClientCertFile == "" && !config.InsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CACertFile != "" {
+		pem, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("CA证书中没有可用的证书：" + config.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// wsUrl 正向ws地址，WsAddr未指定协议时根据UseTLS选择ws或wss
+func (config *Config) wsUrl() (*url.URL, error) {
+	addr := config.WsAddr
+	if !strings.Contains(addr, "://") {
+		scheme := "ws"
+		if config.UseTLS {
+			scheme = "wss"
+		}
+		addr = scheme + "://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.AccessToken != "" && !config.TokenInHeader {
+		values := u.Query()
+		values.Add("access_token", config.AccessToken)
+		u.RawQuery = values.Encode()
+	}
+	return u, nil
+}
+
+// callBackAddr http接口地址，CallBackAddr未指定协议时根据UseTLS选择http或https
+func (config *Config) callBackAddr() string {
+	if config.CallBackAddr == "" || strings.Contains(config.CallBackAddr, "://") {
+		return config.CallBackAddr
+	}
+	if config.UseTLS {
+		return "https://" + config.CallBackAddr
+	}
+	return "http://" + config.CallBackAddr
+}
+
+// authHeader 开启TokenInHeader时通过Authorization请求头发送access token
+func (config *Config) authHeader() http.Header {
+	header := http.Header{}
+	if config.AccessToken != "" && config.TokenInHeader {
+		header.Set("Authorization", "Bearer "+config.AccessToken)
+	}
+	return header
+}
+
+// authorize 为http请求附加access token
+func (config *Config) authorize(req *http.Request) {
+	if config.AccessToken == "" {
+		return
+	}
+	if config.TokenInHeader {
+		req.Header.Set("Authorization", "Bearer "+config.AccessToken)
+		return
+	}
+	values := req.URL.Query()
+	values.Set("access_token", config.AccessToken)
+	req.URL.RawQuery = values.Encode()
+}
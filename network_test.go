@@ -0,0 +1,50 @@
+package ranni
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_httpTransport_TLS(t *testing.T) {
+	// 自签名证书的https服务，要求token通过请求头传递
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.URL.Query().Has("access_token") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok","retcode":0,"data":{"user_id":10000,"nickname":"ranni"}}`))
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bot := New(&Config{
+		CallBackAddr:  strings.TrimPrefix(server.URL, "https://"),
+		UseTLS:        true,
+		CACertFile:    caFile,
+		AccessToken:   "secret",
+		TokenInHeader: true,
+	})
+	info, err := bot.FetchBotInfoContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserId != 10000 {
+		t.Errorf("user_id = %d", info.UserId)
+	}
+
+	// 未配置CA时无法通过证书校验
+	bot = New(&Config{CallBackAddr: server.URL, AccessToken: "secret", TokenInHeader: true})
+	if _, err := bot.FetchBotInfoContext(context.Background()); err == nil {
+		t.Error("expected certificate error")
+	}
+}
@@ -0,0 +1,423 @@
+package ranni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"hash/fnv"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// json12 转换v12内容时保留数字原文，避免大整数丢失精度
+var json12 = jsoniter.Config{UseNumber: true}.Froze()
+
+// idKeys v12中为字符串、v11中为整数的字段
+var idKeys = map[string]bool{
+	"self_id":     true,
+	"user_id":     true,
+	"group_id":    true,
+	"message_id":  true,
+	"operator_id": true,
+	"target_id":   true,
+}
+
+// actions12 v11与v12名称不同的action
+var actions12 = map[string]string{
+	"send_msg":       "send_message",
+	"delete_msg":     "delete_message",
+	"get_login_info": "get_self_info",
+}
+
+// oneBot12 v12协议，事件与响应转换为v11格式，action转换为v12格式
+type oneBot12 struct {
+	bot *Bot
+}
+
+func (protocol oneBot12) normalizeEvent(message []byte) ([]byte, error) {
+	event := make(map[string]interface{})
+	if err := json12.Unmarshal(message, &event); err != nil {
+		return nil, err
+	}
+	eventType, ok := event["type"].(string)
+	if !ok {
+		// action的响应等非事件内容
+		return message, nil
+	}
+	detailType, _ := event["detail_type"].(string)
+	subType, _ := event["sub_type"].(string)
+	var selfId interface{}
+	if self, ok := event["self"].(map[string]interface{}); ok {
+		selfId = self["user_id"]
+		event["self_id"] = selfId
+		event["platform"] = self["platform"]
+	}
+	if t, ok := event["time"].(json.Number); ok {
+		seconds, _ := t.Float64()
+		event["time"] = int64(seconds)
+	}
+	switch eventType {
+	case "message":
+		event["post_type"] = "message"
+		event["message_type"] = detailType
+		event["raw_message"] = event["alt_message"]
+		event["sender"] = map[string]interface{}{"user_id": event["user_id"]}
+		message, err := protocol.segmentsFrom12(event["message"])
+		if err != nil {
+			return nil, err
+		}
+		event["message"] = message
+	case "notice":
+		event["post_type"] = "notice"
+		switch detailType {
+		case "group_member_increase":
+			event["notice_type"] = "group_increase"
+			if subType == "join" {
+				event["sub_type"] = "approve"
+			}
+		case "group_member_decrease":
+			event["notice_type"] = "group_decrease"
+			if selfId != nil && event["user_id"] == selfId {
+				event["sub_type"] = "kick_me"
+			}
+		case "group_message_delete":
+			event["notice_type"] = "group_recall"
+		case "private_message_delete":
+			event["notice_type"] = "friend_recall"
+		case "friend_increase":
+			event["notice_type"] = "friend_add"
+		default:
+			event["notice_type"] = detailType
+		}
+	case "request":
+		event["post_type"] = "request"
+		event["request_type"] = detailType
+	case "meta":
+		event["post_type"] = "meta_event"
+		event["meta_event_type"] = detailType
+		if detailType == "connect" {
+			event["meta_event_type"] = "lifecycle"
+			event["sub_type"] = "connect"
+		}
+	}
+	if err := protocol.ids().toIntIds(event); err != nil {
+		return nil, err
+	}
+	return json12.Marshal(event)
+}
+
+func (protocol oneBot12) action(ctx context.Context, action string, params interface{}) (string, interface{}, error) {
+	body, err := json12.Marshal(params)
+	if err != nil {
+		return "", nil, err
+	}
+	values := make(map[string]interface{})
+	if err := json12.Unmarshal(body, &values); err != nil {
+		return "", nil, err
+	}
+	protocol.ids().toStringIds(values)
+	if action == "send_msg" {
+		detailType := values["message_type"]
+		values["detail_type"] = detailType
+		delete(values, "message_type")
+		if detailType == "group" {
+			delete(values, "user_id")
+		} else {
+			delete(values, "group_id")
+		}
+		if values["message"], err = protocol.segmentsTo12(ctx, values["message"]); err != nil {
+			return "", nil, err
+		}
+	}
+	if name, ok := actions12[action]; ok {
+		action = name
+	}
+	return action, values, nil
+}
+
+func (protocol oneBot12) normalizeResponse(action string, body []byte) ([]byte, error) {
+	resp := make(map[string]interface{})
+	if err := json12.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if _, ok := resp["wording"]; !ok {
+		resp["wording"] = resp["message"]
+	}
+	renameUserKeys(resp["data"])
+	if err := protocol.ids().toIntIds(resp); err != nil {
+		return nil, err
+	}
+	return json12.Marshal(resp)
+}
+
+func (protocol oneBot12) ids() *idTable {
+	return &protocol.bot.ids12
+}
+
+// segmentsFrom12 将v12的消息段转换为v11格式
+func (protocol oneBot12) segmentsFrom12(value interface{}) ([]interface{}, error) {
+	segments, _ := value.([]interface{})
+	result := make([]interface{}, 0, len(segments))
+	for _, item := range segments {
+		segment, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		data, _ := segment["data"].(map[string]interface{})
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+		switch segment["type"] {
+		case "mention":
+			qq, err := protocol.ids().intern(toString(data["user_id"]))
+			if err != nil {
+				return nil, err
+			}
+			segment = newSegment(At, map[string]interface{}{"qq": qq})
+		case "mention_all":
+			segment = newSegment(At, map[string]interface{}{"qq": "all"})
+		case "image":
+			segment = newSegment(Image, map[string]interface{}{"file": data["file_id"], "url": data["url"]})
+		case "voice", "audio":
+			segment = newSegment(Record, map[string]interface{}{"file": data["file_id"], "url": data["url"]})
+		case "video":
+			segment = newSegment(Video, map[string]interface{}{"file": data["file_id"], "url": data["url"]})
+		case "reply":
+			id := protocol.ids().internMessage(toString(data["message_id"]))
+			segment = newSegment(Reply, map[string]interface{}{"id": strconv.FormatInt(id, 10)})
+		}
+		result = append(result, segment)
+	}
+	return result, nil
+}
+
+// segmentsTo12 将v11的消息段转换为v12格式，图片、语音、视频会先上传获取file_id
+func (protocol oneBot12) segmentsTo12(ctx context.Context, value interface{}) ([]interface{}, error) {
+	segments, _ := value.([]interface{})
+	result := make([]interface{}, 0, len(segments))
+	for _, item := range segments {
+		segment, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		data, _ := segment["data"].(map[string]interface{})
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+		switch segment["type"] {
+		case At.String():
+			if atAll, _ := data["AtAll"].(bool); atAll {
+				segment = map[string]interface{}{"type": "mention_all", "data": map[string]interface{}{}}
+			} else {
+				segment = map[string]interface{}{"type": "mention", "data": map[string]interface{}{"user_id": protocol.ids().lookup("user_id", toString(data["qq"]))}}
+			}
+		case Image.String(), Record.String(), Video.String():
+			fileId, err := protocol.upload(ctx, toString(data["file"]))
+			if err != nil {
+				return nil, err
+			}
+			segmentType := segment["type"]
+			if segmentType == Record.String() {
+				segmentType = "voice"
+			}
+			segment = map[string]interface{}{"type": segmentType, "data": map[string]interface{}{"file_id": fileId}}
+		case Reply.String():
+			segment = map[string]interface{}{"type": "reply", "data": map[string]interface{}{"message_id": protocol.ids().lookup("message_id", toString(data["id"]))}}
+		}
+		result = append(result, segment)
+	}
+	return result, nil
+}
+
+// upload 上传url、base64://或file://形式的文件并返回file_id，其余内容视为已有的file_id
+func (protocol oneBot12) upload(ctx context.Context, file string) (string, error) {
+	var params map[string]interface{}
+	switch {
+	case strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://"):
+		params = map[string]interface{}{"type": "url", "url": file, "name": path.Base(file)}
+	case strings.HasPrefix(file, "base64://"):
+		params = map[string]interface{}{"type": "data", "data": strings.TrimPrefix(file, "base64://"), "name": "file"}
+	case strings.HasPrefix(file, "file://"):
+		filePath := strings.TrimPrefix(file, "file://")
+		params = map[string]interface{}{"type": "path", "path": filePath, "name": path.Base(filePath)}
+	default:
+		return file, nil
+	}
+	body, err := protocol.bot.transport().Call(ctx, "upload_file", params)
+	if err != nil {
+		return "", err
+	}
+	body, err = protocol.normalizeResponse("upload_file", body)
+	if err != nil {
+		return "", err
+	}
+	if err := checkResponse("upload_file", body); err != nil {
+		return "", err
+	}
+	return jsoniter.Get(body, "data", "file_id").ToString(), nil
+}
+
+func newSegment(messageType MessageType, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": messageType.String(), "data": data}
+}
+
+// maxMessageIds 记录的非数字消息ID数量，超出后覆盖最早的记录
+const maxMessageIds = 1 << 16
+
+// idTable 记录v12中非数字字符串ID与内部整数ID的对应关系，以便在action中还原为原始ID
+type idTable struct {
+	sync.RWMutex
+	ids        map[int64]string
+	messages   map[int64]string // message_id在v11中为int32，按到达顺序循环分配
+	messageIds map[string]int64
+	next       int64
+}
+
+// intern 返回字符串ID对应的整数ID：数字字符串直接转换，其余按哈希映射为负数并记录，同一ID始终映射为同一整数
+func (table *idTable) intern(id string) (int64, error) {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return n, nil
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(id))
+	n := -int64(hash.Sum64()>>1) - 1
+	table.Lock()
+	defer table.Unlock()
+	if table.ids == nil {
+		table.ids = make(map[int64]string)
+	}
+	if existing, ok := table.ids[n]; ok && existing != id {
+		return 0, fmt.Errorf("ID %s 与 %s 冲突", id, existing)
+	}
+	table.ids[n] = id
+	return n, nil
+}
+
+// internMessage 返回消息ID对应的int32范围内的整数，非数字的消息ID只保留最近maxMessageIds条
+func (table *idTable) internMessage(id string) int64 {
+	if n, err := strconv.ParseInt(id, 10, 32); err == nil {
+		return n
+	}
+	table.Lock()
+	defer table.Unlock()
+	if table.messages == nil {
+		table.messages = make(map[int64]string)
+		table.messageIds = make(map[string]int64)
+	}
+	if n, ok := table.messageIds[id]; ok {
+		return n
+	}
+	n := -(table.next % maxMessageIds) - 1
+	table.next++
+	if old, ok := table.messages[n]; ok {
+		delete(table.messageIds, old)
+	}
+	table.messages[n] = id
+	table.messageIds[id] = n
+	return n
+}
+
+// lookup 将整数ID还原为字符串ID，未记录的ID按数字原样返回
+func (table *idTable) lookup(key string, id string) string {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n >= 0 {
+		return id
+	}
+	table.RLock()
+	defer table.RUnlock()
+	ids := table.ids
+	if key == "message_id" {
+		ids = table.messages
+	}
+	if original, ok := ids[n]; ok {
+		return original
+	}
+	return id
+}
+
+// toIntIds 将ID字段由字符串转换为整数，非数字的ID通过intern映射
+func (table *idTable) toIntIds(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if idKeys[key] {
+				if id, ok := item.(string); ok {
+					if key == "message_id" {
+						v[key] = table.internMessage(id)
+						continue
+					}
+					n, err := table.intern(id)
+					if err != nil {
+						return err
+					}
+					v[key] = n
+					continue
+				}
+			}
+			if err := table.toIntIds(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := table.toIntIds(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// toStringIds 将ID字段由整数转换为字符串，映射过的ID还原为原始字符串
+func (table *idTable) toStringIds(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if idKeys[key] {
+				if id, ok := item.(json.Number); ok {
+					v[key] = table.lookup(key, id.String())
+					continue
+				}
+			}
+			table.toStringIds(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			table.toStringIds(item)
+		}
+	}
+}
+
+// renameUserKeys 将v12用户信息中的字段名转换为v11的字段名
+func renameUserKeys(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if name, ok := v["user_name"]; ok {
+			v["nickname"] = name
+		}
+		if displayName, ok := v["user_displayname"]; ok {
+			v["card"] = displayName
+		}
+	case []interface{}:
+		for _, item := range v {
+			renameUserKeys(item)
+		}
+	}
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	default:
+		s, _ := json12.MarshalToString(v)
+		return s
+	}
+}
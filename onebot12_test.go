@@ -0,0 +1,100 @@
+package ranni
+
+import (
+	"context"
+	json "github.com/json-iterator/go"
+	"testing"
+)
+
+func Test_oneBot12_normalizeEvent(t *testing.T) {
+	bot := New(&Config{ProtocolVersion: OneBot12})
+	frame := `{"id":"b6e65187","time":1632847927.599013,"type":"message","detail_type":"group","sub_type":"",` +
+		`"message_id":"6283","self":{"platform":"qq","user_id":"10001"},"group_id":"123","user_id":"456",` +
+		`"message":[{"type":"mention","data":{"user_id":"10001"}},{"type":"text","data":{"text":" ping"}}],"alt_message":"@bot ping"}`
+	event, err := bot.decodeEvent([]byte(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupMessage, ok := event.(GroupMessageEvent)
+	if !ok {
+		t.Fatalf("expect GroupMessageEvent, got %T", event)
+	}
+	if groupMessage.SelfId != 10001 || groupMessage.GroupId != 123 || groupMessage.Sender.UserId != 456 ||
+		groupMessage.MessageId != 6283 || groupMessage.Time != 1632847927 || groupMessage.Platform != "qq" {
+		t.Fatalf("unexpected event %+v", groupMessage)
+	}
+	if !groupMessage.ContainsAt(10001) || groupMessage.MessageChain.String() != "ping" {
+		t.Fatalf("unexpected message chain %+v", groupMessage.MessageChain)
+	}
+
+	frame = `{"type":"notice","detail_type":"group_member_decrease","sub_type":"kick","time":1,` +
+		`"self":{"platform":"qq","user_id":"10001"},"group_id":"123","user_id":"10001","operator_id":"456"}`
+	event, err = bot.decodeEvent([]byte(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrease, ok := event.(GroupDecreaseNoticeEvent)
+	if !ok || decrease.SubType != "kick_me" || decrease.OperatorId != 456 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
+
+func Test_oneBot12_action(t *testing.T) {
+	protocol := oneBot12{bot: New(&Config{ProtocolVersion: OneBot12})}
+	chain := NewMsgChain().AddAt(456).AddText("hi")
+	action, params, err := protocol.action(context.Background(), "send_msg", SendMessageMO{
+		MessageType: GroupMessageEventType.String(),
+		UserId:      123,
+		GroupId:     123,
+		Message:     *buildMessageMO(chain),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(params)
+	if action != "send_message" || json.Get(body, "detail_type").ToString() != "group" ||
+		json.Get(body, "group_id").ValueType() != json.StringValue || json.Get(body, "user_id").ValueType() != json.InvalidValue {
+		t.Fatalf("unexpected action %s %s", action, body)
+	}
+	if json.Get(body, "message", 0, "type").ToString() != "mention" || json.Get(body, "message", 0, "data", "user_id").ToString() != "456" {
+		t.Fatalf("unexpected message %s", body)
+	}
+}
+
+func Test_oneBot12_stringIds(t *testing.T) {
+	bot := New(&Config{ProtocolVersion: OneBot12})
+	frame := `{"id":"1","time":1,"type":"message","detail_type":"group","sub_type":"","message_id":"m-1",` +
+		`"self":{"platform":"kook","user_id":"bot"},"group_id":"abc","user_id":"u-456",` +
+		`"message":[{"type":"mention","data":{"user_id":"bot"}},{"type":"text","data":{"text":"ping"}}],"alt_message":"ping"}`
+	event, err := bot.decodeEvent([]byte(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupMessage, ok := event.(GroupMessageEvent)
+	if !ok || groupMessage.GroupId == 0 || groupMessage.Sender.UserId == 0 || !groupMessage.ContainsAt(groupMessage.SelfId) {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	ctx := bot.newEventContext(event)
+	if !ctx.isGroup() {
+		t.Fatal("string group id should still be a group message")
+	}
+	_, params, err := bot.protocol().action(context.Background(), "send_msg", SendMessageMO{
+		MessageType: GroupMessageEventType.String(),
+		GroupId:     ctx.GroupId,
+		Message:     *buildMessageMO(NewMsgChain().AddAt(ctx.UserId)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(params)
+	if json.Get(body, "group_id").ToString() != "abc" || json.Get(body, "message", 0, "data", "user_id").ToString() != "u-456" {
+		t.Fatalf("string ids not restored: %s", body)
+	}
+	_, params, err = bot.protocol().action(context.Background(), "delete_msg", map[string]int32{"message_id": groupMessage.MessageId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ = json.Marshal(params); json.Get(body, "message_id").ToString() != "m-1" {
+		t.Fatalf("message id not restored: %s", body)
+	}
+}
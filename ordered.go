@@ -0,0 +1,199 @@
+package ranni
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// subjectKey 会话标识，区分群号与QQ号相同的情况
+type subjectKey struct {
+	group bool
+	id    int64
+}
+
+// subjectQueue 同一会话中等待处理的事件
+type subjectQueue struct {
+	runs []*eventRun
+}
+
+// orderedDispatcher 按会话串行处理事件，不同会话之间并行
+type orderedDispatcher struct {
+	sync.Mutex
+	queues  map[subjectKey]*subjectQueue
+	pending int // 所有会话中排队的事件数，开启协程池时上限为QueueSize
+}
+
+// subjectLease 正在处理的事件对会话的占用，释放后同一会话的后续事件不再等待该事件
+type subjectLease struct {
+	released   int32
+	bot        *Bot
+	key        subjectKey
+	dispatcher *orderedDispatcher
+}
+
+// take 取回会话的处理权，已被release提前释放时返回false
+func (lease *subjectLease) take() bool {
+	return atomic.CompareAndSwapInt32(&lease.released, 0, 1)
+}
+
+// release 提前释放会话，由新的job继续处理后续事件；开启协程池时放入恢复队列，不受队列容量限制
+func (lease *subjectLease) release() {
+	if !lease.take() {
+		return
+	}
+	next, ok := lease.dispatcher.next(lease.key)
+	if !ok {
+		return
+	}
+	bot, key, dispatcher := lease.bot, lease.key, lease.dispatcher
+	drain := poolJob{
+		run: func() {
+			dispatcher.drain(bot, key, next)
+		},
+		drop: func() {
+			dispatcher.drop(bot, key, next)
+		},
+	}
+	if bot.poolEnabled() {
+		bot.pool.park()
+		bot.pool.resume(drain)
+		return
+	}
+	go drain.run()
+}
+
+// releaseSubject 当前事件不再占用会话，WaitNext等待期间同一会话的其他事件照常处理
+func (event *EventContext) releaseSubject() {
+	if event.subject != nil {
+		event.subject.release()
+	}
+}
+
+func (bot *Bot) orderedEnabled() bool {
+	return bot.config != nil && bot.config.OrderedDispatch
+}
+
+// subjectOf 事件所属会话，元事件等没有会话的事件返回false
+func subjectOf(context *EventContext) (subjectKey, bool) {
+	id := context.GetSubjectId()
+	if id == -1 {
+		return subjectKey{}, false
+	}
+	return subjectKey{group: context.isGroup(), id: id}, true
+}
+
+// enqueue 会话中没有正在处理的事件时立即开始处理，否则排在其后
+func (dispatcher *orderedDispatcher) enqueue(bot *Bot, key subjectKey, run *eventRun) {
+	dispatcher.Lock()
+	if dispatcher.queues == nil {
+		dispatcher.queues = make(map[subjectKey]*subjectQueue)
+	}
+	if queue, ok := dispatcher.queues[key]; ok {
+		dropped := dispatcher.trim(bot, queue, run)
+		dispatcher.Unlock()
+		if dropped != nil {
+			bot.pool.drop(dropped.job())
+		}
+		return
+	}
+	dispatcher.queues[key] = &subjectQueue{}
+	dispatcher.Unlock()
+	drain := poolJob{
+		run: func() {
+			dispatcher.drain(bot, key, run)
+		},
+		drop: func() {
+			dispatcher.drop(bot, key, run)
+		},
+	}
+	if bot.poolEnabled() {
+		bot.pool.submit(bot, drain)
+		return
+	}
+	go drain.run()
+}
+
+// trim 将事件排在会话末尾。开启协程池时所有会话合计最多排队QueueSize个事件，超出时按Overflow丢弃：
+// drop_oldest丢弃该会话中最早的事件，其余策略丢弃新事件，避免排队的事件阻塞所有会话。返回被丢弃的事件，调用方需持有锁
+func (dispatcher *orderedDispatcher) trim(bot *Bot, queue *subjectQueue, run *eventRun) *eventRun {
+	if bot.poolEnabled() && dispatcher.pending >= bot.poolSize() {
+		if bot.config.WorkerPool.Overflow != OverflowDropOldest || len(queue.runs) == 0 {
+			return run
+		}
+		dropped := queue.runs[0]
+		queue.runs[0] = nil
+		queue.runs = append(queue.runs[1:], run)
+		return dropped
+	}
+	queue.runs = append(queue.runs, run)
+	dispatcher.pending++
+	return nil
+}
+
+// drain 依次处理会话中的事件，直到队列为空。事件因handler没有空位暂停时先返回，
+// 恢复执行完毕后由同一会话继续处理，后续事件始终排在其后
+func (dispatcher *orderedDispatcher) drain(bot *Bot, key subjectKey, run *eventRun) {
+	for {
+		lease := &subjectLease{bot: bot, key: key, dispatcher: dispatcher}
+		run.context.subject = lease
+		run.after = func() {
+			if !lease.take() {
+				return
+			}
+			if next, ok := dispatcher.next(key); ok {
+				dispatcher.drain(bot, key, next)
+			}
+		}
+		if !run.step() || !lease.take() {
+			return
+		}
+		next, ok := dispatcher.next(key)
+		if !ok {
+			return
+		}
+		run = next
+	}
+}
+
+// next 取出会话中的下一个事件，队列为空时移除该会话
+func (dispatcher *orderedDispatcher) next(key subjectKey) (*eventRun, bool) {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+	queue := dispatcher.queues[key]
+	if len(queue.runs) == 0 {
+		delete(dispatcher.queues, key)
+		return nil, false
+	}
+	run := queue.runs[0]
+	queue.runs[0] = nil
+	queue.runs = queue.runs[1:]
+	dispatcher.pending--
+	return run, true
+}
+
+// drop 丢弃正要处理的事件及会话中积压的事件
+func (dispatcher *orderedDispatcher) drop(bot *Bot, key subjectKey, run *eventRun) {
+	run.drop()
+	for _, queued := range dispatcher.remove(key) {
+		bot.pool.drop(queued.job())
+	}
+}
+
+// remove 移除会话并返回其中积压的事件
+func (dispatcher *orderedDispatcher) remove(key subjectKey) []*eventRun {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+	queue := dispatcher.queues[key]
+	delete(dispatcher.queues, key)
+	if queue == nil {
+		return nil
+	}
+	dispatcher.pending -= len(queue.runs)
+	return queue.runs
+}
+
+func (dispatcher *orderedDispatcher) len() int {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+	return dispatcher.pending
+}
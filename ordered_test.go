@@ -0,0 +1,132 @@
+package ranni
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBot_OrderedDispatch(t *testing.T) {
+	for _, pool := range []bool{false, true} {
+		bot := New(&Config{OrderedDispatch: true, WorkerPool: WorkerPoolConfig{Enable: pool, Workers: 2}})
+		lock := &sync.Mutex{}
+		received := make(map[int64][]string)
+		bot.Register(funcHandler{do: func(ctx *EventContext) {
+			// 越早的消息处理越慢，无序处理时顺序会被打乱
+			n, _ := strconv.Atoi(ctx.MessageChain.String())
+			time.Sleep(time.Duration(10-n) * time.Millisecond)
+			lock.Lock()
+			defer lock.Unlock()
+			received[ctx.GroupId] = append(received[ctx.GroupId], ctx.MessageChain.String())
+		}})
+		var waits []*sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			for _, groupId := range []int64{1, 2} {
+				event := GroupMessageEvent{GroupId: groupId}
+				event.MessageChain = *NewMsgChain().AddText(strconv.Itoa(i))
+				_, wg := bot.dispatch(event)
+				waits = append(waits, wg)
+			}
+		}
+		for _, wg := range waits {
+			wg.Wait()
+		}
+		for _, groupId := range []int64{1, 2} {
+			texts := received[groupId]
+			if len(texts) != 10 {
+				t.Fatalf("pool=%v group %d received %v", pool, groupId, texts)
+			}
+			for i, text := range texts {
+				if text != strconv.Itoa(i) {
+					t.Errorf("pool=%v group %d received %v out of order", pool, groupId, texts)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestBot_OrderedDispatchWithLimitedHandler(t *testing.T) {
+	bot := New(&Config{OrderedDispatch: true, WorkerPool: WorkerPoolConfig{Enable: true, Workers: 2}})
+	lock := &sync.Mutex{}
+	received := make(map[int64][]string)
+	var running, peak int32
+	bot.Register(limitedHandler{funcHandler: funcHandler{do: func(ctx *EventContext) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+				break
+			}
+		}
+		defer atomic.AddInt32(&running, -1)
+		time.Sleep(time.Millisecond)
+		lock.Lock()
+		defer lock.Unlock()
+		received[ctx.GroupId] = append(received[ctx.GroupId], ctx.MessageChain.String())
+	}}, limit: 1})
+	var waits []*sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, groupId := range []int64{1, 2, 3} {
+			event := GroupMessageEvent{GroupId: groupId}
+			event.MessageChain = *NewMsgChain().AddText(strconv.Itoa(i))
+			_, wg := bot.dispatch(event)
+			waits = append(waits, wg)
+		}
+	}
+	for _, wg := range waits {
+		wg.Wait()
+	}
+	if peak != 1 {
+		t.Errorf("peak concurrency = %d, want 1", peak)
+	}
+	for _, groupId := range []int64{1, 2, 3} {
+		texts := received[groupId]
+		if len(texts) != 10 {
+			t.Fatalf("group %d received %v", groupId, texts)
+		}
+		for i, text := range texts {
+			if text != strconv.Itoa(i) {
+				t.Errorf("group %d received %v out of order", groupId, texts)
+				break
+			}
+		}
+	}
+}
+
+func TestBot_OrderedDispatchQueueLimit(t *testing.T) {
+	bot := New(&Config{OrderedDispatch: true, WorkerPool: WorkerPoolConfig{Enable: true, Workers: 1, QueueSize: 2}})
+	var running, peak, calls int32
+	release := make(chan struct{})
+	bot.Register(blocking(release, &running, &peak, 0))
+	bot.Register(counting(&calls))
+	var waits []*sync.WaitGroup
+	dispatch := func(groupId int64) {
+		_, wg := bot.dispatch(GroupMessageEvent{GroupId: groupId})
+		waits = append(waits, wg)
+	}
+	dispatch(1)
+	for atomic.LoadInt32(&running) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// 群1的两个事件占满会话队列的总容量，群2的第一个事件进入协程池，第二个被丢弃
+	dispatch(1)
+	dispatch(1)
+	dispatch(2)
+	dispatch(2)
+	if stats := bot.PoolStats(); stats.Ordered != 2 || stats.QueueDepth != 1 || stats.Dropped != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	close(release)
+	for _, wg := range waits {
+		wg.Wait()
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 4 {
+		t.Errorf("handled %d events, want 4", calls)
+	}
+	if stats := bot.PoolStats(); stats.Ordered != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,156 @@
+package ranni
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Permission 权限等级，数值越大权限越高
+type Permission int
+
+const (
+	PermissionMember     Permission = iota // 普通成员及私聊用户
+	PermissionGroupAdmin                   // 群管理员
+	PermissionGroupOwner                   // 群主
+	PermissionSuperUser                    // Config.SuperUsers中的超级用户
+)
+
+func (permission Permission) String() string {
+	switch permission {
+	case PermissionMember:
+		return "member"
+	case PermissionGroupAdmin:
+		return "admin"
+	case PermissionGroupOwner:
+		return "owner"
+	case PermissionSuperUser:
+		return "superuser"
+	default:
+		return "unknown"
+	}
+}
+
+const permissionKeyPrefix = "perm:"
+
+// IsSuperUser 判断QQ号是否为超级用户
+func (bot *Bot) IsSuperUser(userId int64) bool {
+	if bot.config == nil {
+		return false
+	}
+	for _, id := range bot.config.SuperUsers {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// Permission 发送人的权限等级，群内根据Sender.Role判断
+func (event *EventContext) Permission() Permission {
+	if event.Bot != nil && event.Bot.IsSuperUser(event.UserId) {
+		return PermissionSuperUser
+	}
+	if event.GroupId != 0 {
+		switch event.Sender.Role {
+		case "owner":
+			return PermissionGroupOwner
+		case "admin":
+			return PermissionGroupAdmin
+		}
+	}
+	return PermissionMember
+}
+
+// HasPermission 发送人是否被授予了自定义权限name，超级用户拥有全部权限
+func (event *EventContext) HasPermission(name string) bool {
+	if event.Permission() == PermissionSuperUser {
+		return true
+	}
+	return event.Bot.HasPermission(event.GroupId, event.UserId, name)
+}
+
+// RequirePermission 权限中间件，发送人等级不低于level或拥有names中任一自定义权限时才执行handler，
+// reply不为空时在权限不足时回复
+func RequirePermission(level Permission, reply string, names ...string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *EventContext) error {
+			if ctx.Permission() >= level {
+				return next(ctx)
+			}
+			for _, name := range names {
+				if ctx.HasPermission(name) {
+					return next(ctx)
+				}
+			}
+			if reply != "" {
+				replyText(ctx, reply)
+			}
+			return nil
+		}
+	}
+}
+
+// permissionKey groupId为0时表示在所有群及私聊中生效
+func permissionKey(groupId, userId int64, name string) string {
+	return permissionKeyPrefix + name + ":" + strconv.FormatInt(userId, 10) + ":" + strconv.FormatInt(groupId, 10)
+}
+
+// Grant 授予QQ号自定义权限，groupId为0时在所有群及私聊中生效，保存在Store中
+func (bot *Bot) Grant(groupId, userId int64, name string) error {
+	return bot.Store().Set(permissionKey(groupId, userId, name), []byte("1"), 0)
+}
+
+// Revoke 撤销Grant授予的权限
+func (bot *Bot) Revoke(groupId, userId int64, name string) error {
+	return bot.Store().Delete(permissionKey(groupId, userId, name))
+}
+
+// HasPermission 判断QQ号在群中是否拥有自定义权限，包含全局授予的权限
+func (bot *Bot) HasPermission(groupId, userId int64, name string) bool {
+	if bot.IsSuperUser(userId) {
+		return true
+	}
+	for _, key := range []string{permissionKey(groupId, userId, name), permissionKey(0, userId, name)} {
+		_, ok, err := bot.Store().Get(key)
+		if err != nil {
+			log.Println("读取权限失败：", err)
+			return false
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions 列出QQ号被授予的自定义权限，key为权限名，value为生效的群号（0为全局）
+func (bot *Bot) Permissions(userId int64) (map[string][]int64, error) {
+	keys, err := bot.Store().Keys(permissionKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	permissions := make(map[string][]int64)
+	user := strconv.FormatInt(userId, 10)
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimPrefix(key, permissionKeyPrefix), ":")
+		if len(parts) < 3 || parts[len(parts)-2] != user {
+			continue
+		}
+		groupId, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		name := strings.Join(parts[:len(parts)-2], ":")
+		permissions[name] = append(permissions[name], groupId)
+	}
+	return permissions, nil
+}
+
+func Grant(groupId, userId int64, name string) error {
+	return engine.Grant(groupId, userId, name)
+}
+
+func Revoke(groupId, userId int64, name string) error {
+	return engine.Revoke(groupId, userId, name)
+}
@@ -0,0 +1,43 @@
+package ranni
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRequirePermission(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	bot := New(&Config{SuperUsers: []int64{1}, StorePath: path})
+	var calls int32
+	bot.Register(counting(&calls), RequirePermission(PermissionGroupAdmin, "", "ban"))
+	message := func(userId int64, role string) GroupMessageEvent {
+		event := GroupMessageEvent{GroupId: 100}
+		event.Sender.UserId = userId
+		event.Sender.Role = role
+		return event
+	}
+	if err := bot.Grant(100, 3, "ban"); err != nil {
+		t.Fatal(err)
+	}
+	// 超级用户、群主、被授权成员可执行，普通成员不可
+	for _, event := range []GroupMessageEvent{message(1, "member"), message(2, "owner"), message(3, "member"), message(4, "member")} {
+		_, wg := bot.dispatch(event)
+		wg.Wait()
+	}
+	if calls != 3 {
+		t.Errorf("handler called %d times, want 3", calls)
+	}
+
+	// 授权保存在文件中，重启后仍然有效
+	restarted := New(&Config{StorePath: path})
+	if !restarted.HasPermission(100, 3, "ban") || restarted.HasPermission(200, 3, "ban") {
+		t.Error("granted permission not persisted")
+	}
+	permissions, err := restarted.Permissions(3)
+	if err != nil || len(permissions["ban"]) != 1 || permissions["ban"][0] != 100 {
+		t.Errorf("permissions = %v, %v", permissions, err)
+	}
+	if err := restarted.Revoke(100, 3, "ban"); err != nil || restarted.HasPermission(100, 3, "ban") {
+		t.Error("permission not revoked")
+	}
+}
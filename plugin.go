@@ -0,0 +1,178 @@
+package ranni
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	pluginKeyPrefix = "plugin:"
+	pluginCommandId = "plugin"
+)
+
+// IdentifiedHandler 可选接口，提供handler的稳定ID，用于按群开关handler及保存状态。
+// 未实现时使用handler的类型名，Command使用命令名；ID重复时依次追加#2、#3
+type IdentifiedHandler interface {
+	ID() string
+}
+
+// ID Command以命令名作为handler ID
+func (command *Command) ID() string {
+	return command.Name
+}
+
+func handlerId(handler EventHandler) string {
+	if identified, ok := handler.(IdentifiedHandler); ok && identified.ID() != "" {
+		return identified.ID()
+	}
+	return fmt.Sprintf("%T", handler)
+}
+
+// uniqueId 为重复的ID追加序号
+func uniqueId(listeners []*registeredHandler, id string) string {
+	unique := id
+	for i := 2; lookupHandler(listeners, unique) != nil; i++ {
+		unique = id + "#" + strconv.Itoa(i)
+	}
+	return unique
+}
+
+func lookupHandler(listeners []*registeredHandler, id string) *registeredHandler {
+	for _, registered := range listeners {
+		if registered.id == id {
+			return registered
+		}
+	}
+	return nil
+}
+
+func (bot *Bot) findHandler(id string) *registeredHandler {
+	return lookupHandler(bot.listeners(), id)
+}
+
+func pluginGroupKey(id string, groupId int64) string {
+	return pluginKeyPrefix + id + ":group:" + strconv.FormatInt(groupId, 10)
+}
+
+func pluginUserKey(id string, userId int64) string {
+	return pluginKeyPrefix + id + ":user:" + strconv.FormatInt(userId, 10)
+}
+
+// PluginEnabled 判断handler在群中及对用户是否开启，groupId为0时只判断用户
+func (bot *Bot) PluginEnabled(id string, groupId, userId int64) bool {
+	keys := []string{pluginUserKey(id, userId)}
+	if groupId != 0 {
+		keys = append(keys, pluginGroupKey(id, groupId))
+	}
+	for _, key := range keys {
+		_, disabled, err := bot.Store().Get(key)
+		if err != nil {
+			log.Println("读取handler开关失败：", err)
+			return true
+		}
+		if disabled {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPluginEnabled 开关群中的handler，groupId为0时对userId在所有会话中生效
+func (bot *Bot) SetPluginEnabled(id string, groupId, userId int64, enabled bool) error {
+	if bot.findHandler(id) == nil {
+		return fmt.Errorf("handler %s 不存在", id)
+	}
+	if id == pluginCommandId {
+		return fmt.Errorf("不能关闭%s", pluginCommandId)
+	}
+	key := pluginGroupKey(id, groupId)
+	if groupId == 0 {
+		key = pluginUserKey(id, userId)
+	}
+	if enabled {
+		return bot.Store().Delete(key)
+	}
+	return bot.Store().Set(key, []byte("0"), 0)
+}
+
+// HelpNoticeFor 生成会话中的使用指南，只包含开启的handler，关闭的handler列在末尾
+func (bot *Bot) HelpNoticeFor(groupId, userId int64) string {
+	notice := "使 用 指 南\n"
+	var disabled []string
+	for _, registered := range bot.listeners() {
+		if !bot.PluginEnabled(registered.id, groupId, userId) {
+			disabled = append(disabled, registered.id)
+			continue
+		}
+		notice += "\n" + registered.help
+	}
+	if len(disabled) != 0 {
+		notice += "\n\n已关闭：" + strings.Join(disabled, "、")
+	}
+	return notice
+}
+
+// HelpNotice 当前会话的使用指南
+func (event *EventContext) HelpNotice() string {
+	return event.Bot.HelpNoticeFor(event.GroupId, event.UserId)
+}
+
+// registerPluginCommand 注册内置的/plugin命令
+func (bot *Bot) registerPluginCommand() {
+	if bot.findHandler(pluginCommandId) != nil {
+		return
+	}
+	target := []Arg{
+		{Name: "id", Type: ArgString},
+		{Name: "user", Type: ArgAt, Optional: true, Description: "指定时对该用户开关，需超级用户"},
+	}
+	bot.Register(&Command{
+		Name:        pluginCommandId,
+		Description: "管理功能开关",
+		Subcommands: []*Command{
+			{Name: "list", Description: "查看功能及在当前会话中的状态", Handler: bot.listPlugins},
+			{Name: "enable", Description: "开启功能", Args: target, Handler: func(ctx *EventContext) { bot.togglePlugin(ctx, true) }},
+			{Name: "disable", Description: "关闭功能", Args: target, Handler: func(ctx *EventContext) { bot.togglePlugin(ctx, false) }},
+		},
+	})
+}
+
+func (bot *Bot) listPlugins(ctx *EventContext) {
+	lines := []string{"功能列表："}
+	for _, registered := range bot.listeners() {
+		state := "开启"
+		if !bot.PluginEnabled(registered.id, ctx.GroupId, ctx.UserId) {
+			state = "关闭"
+		}
+		lines = append(lines, registered.id+"："+state)
+	}
+	replyText(ctx, strings.Join(lines, "\n"))
+}
+
+// togglePlugin 群内开关需群管理员，对其他用户开关需超级用户，私聊中可为自己开关
+func (bot *Bot) togglePlugin(ctx *EventContext, enabled bool) {
+	id := ctx.Args.GetString("id")
+	groupId, userId := ctx.GroupId, ctx.UserId
+	required := PermissionMember
+	if ctx.Args.Has("user") {
+		groupId, userId = 0, ctx.Args.GetInt("user")
+		required = PermissionSuperUser
+	} else if groupId != 0 {
+		required = PermissionGroupAdmin
+	}
+	if ctx.Permission() < required {
+		replyText(ctx, "权限不足")
+		return
+	}
+	if err := bot.SetPluginEnabled(id, groupId, userId, enabled); err != nil {
+		replyText(ctx, err.Error())
+		return
+	}
+	state := "关闭"
+	if enabled {
+		state = "开启"
+	}
+	replyText(ctx, "已"+state+id)
+}
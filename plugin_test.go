@@ -0,0 +1,39 @@
+package ranni
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBot_SetPluginEnabled(t *testing.T) {
+	bot := New(&Config{})
+	var calls int32
+	handler := counting(&calls)
+	handler.id = "count"
+	bot.Register(handler)
+	bot.Register(handler)
+	bot.registerPluginCommand()
+	if bot.findHandler("count#2") == nil {
+		t.Fatal("duplicate handler id not made unique")
+	}
+	if err := bot.SetPluginEnabled("count", 1, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.SetPluginEnabled(pluginCommandId, 1, 0, false); err == nil {
+		t.Error("plugin command should not be disabled")
+	}
+	for _, groupId := range []int64{1, 2} {
+		event := GroupMessageEvent{GroupId: groupId}
+		_, wg := bot.dispatch(event)
+		wg.Wait()
+	}
+	if calls != 3 {
+		t.Errorf("handlers called %d times, want 3", calls)
+	}
+	if notice := bot.HelpNoticeFor(1, 0); !strings.Contains(notice, "已关闭：count") || !strings.Contains(notice, "/plugin list") {
+		t.Errorf("help notice = %q", notice)
+	}
+	if notice := bot.HelpNoticeFor(2, 0); strings.Contains(notice, "已关闭") {
+		t.Errorf("help notice = %q", notice)
+	}
+}
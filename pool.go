@@ -0,0 +1,479 @@
+package ranni
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	OverflowBlock      = "block"       // 队列满时等待空位；连接中读到的事件最多暂存QueueSize条，不阻塞读取，超出时丢弃最新的事件
+	OverflowDropNewest = "drop_newest" // 队列满时丢弃新事件
+	OverflowDropOldest = "drop_oldest" // 队列满时丢弃队列中最早的事件
+
+	defaultPoolQueueSize = 1024
+)
+
+// WorkerPoolConfig 事件处理协程池配置
+type WorkerPoolConfig struct {
+	Enable    bool   `yaml:"enable"`     // 开启后事件进入有界队列，由固定数量的协程处理
+	Workers   int    `yaml:"workers"`    // 处理事件的协程数，默认为CPU核数×4
+	QueueSize int    `yaml:"queue_size"` // 等待处理的事件数上限，默认1024
+	Overflow  string `yaml:"overflow"`   // 队列满时的策略：block(默认)、drop_newest、drop_oldest
+
+	MaxHandlerConcurrency int `yaml:"max_handler_concurrency"` // 单个handler同时处理的事件数，0为不限制，不开启Enable时同样生效
+}
+
+// ConcurrencyLimitedHandler 可选接口，指定handler同时处理的事件数，优先于MaxHandlerConcurrency
+type ConcurrencyLimitedHandler interface {
+	MaxConcurrency() int
+}
+
+// PoolStats 协程池运行状态
+type PoolStats struct {
+	QueueDepth int    // 队列中等待处理的事件数
+	QueueSize  int    // 队列容量，等待handler空位的事件同样占用容量
+	Waiting    int    // 等待handler并发空位的事件数
+	Backlog    int    // 连接中读到、尚未放入队列的事件数，上限为QueueSize
+	Ordered    int    // 开启OrderedDispatch时排在同一会话其他事件之后的事件数，上限为QueueSize
+	Workers    int    // 协程数
+	Busy       int    // 正在处理事件的协程数
+	Processed  uint64 // 已处理的事件数
+	Dropped    uint64 // 因队列已满或bot停止而丢弃的事件数
+}
+
+// poolJob 队列中的一个事件，drop在事件被丢弃时调用
+type poolJob struct {
+	run  func()
+	drop func()
+}
+
+type workerPool struct {
+	once     sync.Once
+	lock     sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	jobs     []poolJob // 新提交的事件
+	resumed  []poolJob // 取得handler空位后恢复执行的事件，优先于新事件且不会因队列已满被丢弃
+	parked   int       // 等待空位及已恢复、尚未取出的事件数
+	size     int
+	stopped  bool
+
+	workers   int
+	busy      int32
+	processed uint64
+	dropped   uint64
+}
+
+func (bot *Bot) poolEnabled() bool {
+	return bot.config != nil && bot.config.WorkerPool.Enable
+}
+
+func (bot *Bot) poolSize() int {
+	if size := bot.config.WorkerPool.QueueSize; size > 0 {
+		return size
+	}
+	return defaultPoolQueueSize
+}
+
+// start 首次提交事件时启动协程，bot停止后丢弃队列中的事件并退出
+func (pool *workerPool) start(bot *Bot) {
+	pool.once.Do(func() {
+		pool.lock.Lock()
+		pool.notEmpty = sync.NewCond(&pool.lock)
+		pool.notFull = sync.NewCond(&pool.lock)
+		pool.size = bot.poolSize()
+		pool.workers = bot.config.WorkerPool.Workers
+		if pool.workers <= 0 {
+			pool.workers = runtime.NumCPU() * 4
+		}
+		pool.lock.Unlock()
+		for i := 0; i < pool.workers; i++ {
+			go pool.work()
+		}
+		go func() {
+			<-bot.done
+			pool.lock.Lock()
+			pool.stopped = true
+			jobs := append(pool.resumed, pool.jobs...)
+			pool.parked -= len(pool.resumed)
+			pool.jobs, pool.resumed = nil, nil
+			pool.notEmpty.Broadcast()
+			pool.notFull.Broadcast()
+			pool.lock.Unlock()
+			for _, job := range jobs {
+				pool.drop(job)
+			}
+		}()
+	})
+}
+
+func (pool *workerPool) work() {
+	for {
+		pool.lock.Lock()
+		for !pool.stopped && len(pool.jobs) == 0 && len(pool.resumed) == 0 {
+			pool.notEmpty.Wait()
+		}
+		if pool.stopped {
+			pool.lock.Unlock()
+			return
+		}
+		var job poolJob
+		if len(pool.resumed) != 0 {
+			job = pool.resumed[0]
+			pool.resumed[0] = poolJob{}
+			pool.resumed = pool.resumed[1:]
+			pool.parked--
+		} else {
+			job = pool.jobs[0]
+			pool.jobs[0] = poolJob{}
+			pool.jobs = pool.jobs[1:]
+		}
+		pool.notFull.Signal()
+		pool.lock.Unlock()
+		atomic.AddInt32(&pool.busy, 1)
+		job.run()
+		atomic.AddInt32(&pool.busy, -1)
+		atomic.AddUint64(&pool.processed, 1)
+	}
+}
+
+// submit 按Overflow策略将事件放入队列
+func (pool *workerPool) submit(bot *Bot, job poolJob) {
+	pool.start(bot)
+	pool.lock.Lock()
+	for !pool.stopped && len(pool.jobs)+pool.parked >= pool.size {
+		switch bot.config.WorkerPool.Overflow {
+		case OverflowDropNewest:
+			pool.lock.Unlock()
+			pool.drop(job)
+			return
+		case OverflowDropOldest:
+			if len(pool.jobs) == 0 {
+				// 容量全部被等待handler空位的事件占用，它们不会被丢弃
+				pool.lock.Unlock()
+				pool.drop(job)
+				return
+			}
+			oldest := pool.jobs[0]
+			pool.jobs[0] = poolJob{}
+			pool.jobs = pool.jobs[1:]
+			pool.lock.Unlock()
+			pool.drop(oldest)
+			pool.lock.Lock()
+		default:
+			pool.notFull.Wait()
+		}
+	}
+	if pool.stopped {
+		pool.lock.Unlock()
+		pool.drop(job)
+		return
+	}
+	pool.jobs = append(pool.jobs, job)
+	pool.notEmpty.Signal()
+	pool.lock.Unlock()
+}
+
+// park 登记一个等待handler空位的事件，等待期间占用队列容量
+func (pool *workerPool) park() {
+	pool.lock.Lock()
+	pool.parked++
+	pool.lock.Unlock()
+}
+
+// resume 将已取得空位的事件放回队列，由下一个空闲的worker优先执行
+func (pool *workerPool) resume(job poolJob) {
+	pool.lock.Lock()
+	if pool.stopped {
+		pool.parked--
+		pool.lock.Unlock()
+		pool.drop(job)
+		return
+	}
+	pool.resumed = append(pool.resumed, job)
+	pool.notEmpty.Signal()
+	pool.lock.Unlock()
+}
+
+func (pool *workerPool) drop(job poolJob) {
+	atomic.AddUint64(&pool.dropped, 1)
+	job.drop()
+}
+
+// PoolStats 返回协程池的队列深度等指标，未开启协程池时各项为0
+func (bot *Bot) PoolStats() PoolStats {
+	pool := &bot.pool
+	pool.lock.Lock()
+	stats := PoolStats{
+		QueueDepth: len(pool.jobs) + len(pool.resumed),
+		QueueSize:  pool.size,
+		Waiting:    pool.parked - len(pool.resumed),
+		Workers:    pool.workers,
+	}
+	pool.lock.Unlock()
+	stats.Backlog = bot.ingress.len()
+	stats.Ordered = bot.ordered.len()
+	stats.Busy = int(atomic.LoadInt32(&pool.busy))
+	stats.Processed = atomic.LoadUint64(&pool.processed)
+	stats.Dropped = atomic.LoadUint64(&pool.dropped)
+	return stats
+}
+
+// onFrame 处理连接中读到的一帧。action响应在读取协程中直接交给调用方；
+// 开启协程池或按会话顺序处理时事件交给ingress协程依次入队，读取协程不会因队列已满而阻塞，否则每帧一个协程
+func (bot *Bot) onFrame(message []byte) {
+	if bot.wsActions.resolve(message) {
+		return
+	}
+	if !bot.poolEnabled() && !bot.orderedEnabled() {
+		go bot.handleFrame(message)
+		return
+	}
+	event, err := bot.decodeEvent(message)
+	if err != nil {
+		return
+	}
+	// 心跳由bot自身消费，不进入队列，避免队列积压时误判心跳超时
+	if _, ok := event.(HeartbeatMetaEvent); ok {
+		bot.CallEvent(event)
+		return
+	}
+	bot.ingress.push(bot, event)
+}
+
+// frameIngress 保存读取协程收到的事件，由单个协程按到达顺序入队，
+// block策略下阻塞的是该协程而不是读取协程；积压超过QueueSize后按Overflow丢弃，block策略下丢弃最新的事件
+type frameIngress struct {
+	sync.Mutex
+	events  []Event
+	running bool
+}
+
+func (ingress *frameIngress) push(bot *Bot, event Event) {
+	ingress.Lock()
+	defer ingress.Unlock()
+	if len(ingress.events) >= bot.poolSize() {
+		if bot.config.WorkerPool.Overflow != OverflowDropOldest {
+			atomic.AddUint64(&bot.pool.dropped, 1)
+			return
+		}
+		ingress.events[0] = nil
+		ingress.events = ingress.events[1:]
+		atomic.AddUint64(&bot.pool.dropped, 1)
+	}
+	ingress.events = append(ingress.events, event)
+	if !ingress.running {
+		ingress.running = true
+		go ingress.run(bot)
+	}
+}
+
+func (ingress *frameIngress) run(bot *Bot) {
+	for {
+		ingress.Lock()
+		if len(ingress.events) == 0 {
+			ingress.running = false
+			ingress.Unlock()
+			return
+		}
+		event := ingress.events[0]
+		ingress.events[0] = nil
+		ingress.events = ingress.events[1:]
+		ingress.Unlock()
+		bot.CallEvent(event)
+	}
+}
+
+func (ingress *frameIngress) len() int {
+	ingress.Lock()
+	defer ingress.Unlock()
+	return len(ingress.events)
+}
+
+// slotsOf 按handler的并发上限创建空位，不限制时返回nil
+func (bot *Bot) slotsOf(registered *registeredHandler) chan struct{} {
+	registered.slotsOnce.Do(func() {
+		limit := 0
+		if bot.config != nil {
+			limit = bot.config.WorkerPool.MaxHandlerConcurrency
+		}
+		if limited, ok := registered.handler.(ConcurrencyLimitedHandler); ok {
+			limit = limited.MaxConcurrency()
+		}
+		if limit > 0 {
+			registered.slots = make(chan struct{}, limit)
+		}
+	})
+	return registered.slots
+}
+
+// acquireSlot 获取handler的并发空位，返回false时handler未执行。
+// 开启协程池时只尝试一次，没有空位的handler由eventRun暂停事件等待，不占用worker；
+// 否则在当前协程等待空位，ctx结束时返回false
+func (bot *Bot) acquireSlot(context *EventContext, registered *registeredHandler) bool {
+	slots := bot.slotsOf(registered)
+	if slots == nil {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if bot.poolEnabled() {
+		return false
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-context.Context().Done():
+		return false
+	}
+}
+
+// releaseSlot 归还空位，有事件在等待时直接转交给最早等待的事件并将其放回协程池
+func (bot *Bot) releaseSlot(registered *registeredHandler) {
+	if registered.slots == nil {
+		return
+	}
+	registered.waitLock.Lock()
+	if len(registered.waiters) == 0 {
+		<-registered.slots
+		registered.waitLock.Unlock()
+		return
+	}
+	run := registered.waiters[0]
+	registered.waiters[0] = nil
+	registered.waiters = registered.waiters[1:]
+	registered.waitLock.Unlock()
+	run.held = registered
+	bot.pool.resume(run.job())
+}
+
+// park 事件等待handler的空位，返回false表示已经取得空位，无需等待
+func (bot *Bot) park(registered *registeredHandler, run *eventRun) bool {
+	registered.waitLock.Lock()
+	defer registered.waitLock.Unlock()
+	select {
+	case registered.slots <- struct{}{}:
+		run.held = registered
+		return false
+	default:
+	}
+	run.parked = true
+	registered.waiters = append(registered.waiters, run)
+	bot.pool.park()
+	return true
+}
+
+// eventRun 协程池中一个事件的执行进度。某层中有handler没有并发空位时事件暂停在该层，
+// 空位释放后放回协程池从该层继续，因此不占用worker，也不会跳过StopPropagation或打乱会话顺序
+type eventRun struct {
+	bot     *Bot
+	context *EventContext
+	wg      *sync.WaitGroup
+	started bool
+	tiers   [][]*registeredHandler
+	tier    int
+	waiting []*registeredHandler // 当前层中因没有空位尚未执行的handler
+	held    *registeredHandler   // 已转交空位、尚未执行的handler
+	parked  bool
+	after   func() // 暂停过的事件执行完毕后调用，由会话队列继续处理后续事件
+}
+
+func (run *eventRun) job() poolJob {
+	return poolJob{
+		run: func() {
+			run.step()
+		},
+		drop: run.drop,
+	}
+}
+
+// step 从当前进度继续执行，事件暂停时返回false
+func (run *eventRun) step() bool {
+	bot, context := run.bot, run.context
+	if !run.started {
+		run.started = true
+		run.tiers = bot.tiers()
+	}
+	for run.tier < len(run.tiers) {
+		handlers := run.tiers[run.tier]
+		if run.waiting != nil {
+			handlers = run.waiting
+		}
+		blocked, ok := bot.runPooledTier(context, handlers, run.held)
+		run.waiting, run.held = nil, nil
+		if !ok {
+			break
+		}
+		if len(blocked) != 0 {
+			run.waiting = blocked
+			if bot.park(blocked[0], run) {
+				return false
+			}
+			continue
+		}
+		if context.propagationStopped() {
+			break
+		}
+		run.tier++
+	}
+	run.finish()
+	return true
+}
+
+func (run *eventRun) finish() {
+	run.context.cancel()
+	run.wg.Done()
+	if run.parked && run.after != nil {
+		run.after()
+	}
+}
+
+func (run *eventRun) drop() {
+	if run.held != nil {
+		bot := run.bot
+		held := run.held
+		run.held = nil
+		bot.releaseSlot(held)
+	}
+	run.finish()
+}
+
+// runPooledTier 并发执行一层handler并等待结束，按注册顺序返回没有空位而未执行的handler；bot已停止时返回false。
+// held为已取得空位的handler
+func (bot *Bot) runPooledTier(context *EventContext, tier []*registeredHandler, held *registeredHandler) ([]*registeredHandler, bool) {
+	wg := &sync.WaitGroup{}
+	skipped := make([]bool, len(tier))
+	ok := true
+	for i, registered := range tier {
+		if !bot.acquire() {
+			ok = false
+			break
+		}
+		isHeld := registered == held
+		if isHeld {
+			held = nil
+		}
+		wg.Add(1)
+		go func(i int, registered *registeredHandler, isHeld bool) {
+			defer bot.running.Done()
+			defer wg.Done()
+			skipped[i] = !bot.handle(context, registered, isHeld)
+		}(i, registered, isHeld)
+	}
+	wg.Wait()
+	if held != nil {
+		// bot已停止，已取得的空位没有用上
+		bot.releaseSlot(held)
+	}
+	var blocked []*registeredHandler
+	for i, skip := range skipped {
+		if skip {
+			blocked = append(blocked, tier[i])
+		}
+	}
+	return blocked, ok
+}
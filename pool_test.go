@@ -0,0 +1,246 @@
+package ranni
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blocking 阻塞到release关闭的handler，记录同时执行的最大数量
+func blocking(release chan struct{}, running, peak *int32, limit int) limitedHandler {
+	do := func(ctx *EventContext) {
+		current := atomic.AddInt32(running, 1)
+		for {
+			old := atomic.LoadInt32(peak)
+			if current <= old || atomic.CompareAndSwapInt32(peak, old, current) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(running, -1)
+	}
+	return limitedHandler{funcHandler: funcHandler{do: do}, limit: limit}
+}
+
+func TestWorkerPool_dropNewest(t *testing.T) {
+	bot := New(&Config{WorkerPool: WorkerPoolConfig{Enable: true, Workers: 1, QueueSize: 1, Overflow: OverflowDropNewest}})
+	var running, peak int32
+	release := make(chan struct{})
+	bot.Register(blocking(release, &running, &peak, 0))
+	var waits []*sync.WaitGroup
+	_, wg := bot.dispatch(PrivacyMessageEvent{})
+	waits = append(waits, wg)
+	for atomic.LoadInt32(&running) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 2; i++ {
+		_, wg := bot.dispatch(PrivacyMessageEvent{})
+		waits = append(waits, wg)
+	}
+	stats := bot.PoolStats()
+	if stats.QueueDepth != 1 || stats.Dropped != 1 || stats.Busy != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	close(release)
+	for _, wg := range waits {
+		wg.Wait()
+	}
+	deadline := time.Now().Add(time.Second)
+	for bot.PoolStats().Processed != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := bot.PoolStats(); stats.Processed != 2 {
+		t.Errorf("processed = %d, want 2", stats.Processed)
+	}
+}
+
+func TestBot_maxConcurrency(t *testing.T) {
+	bot := New(&Config{})
+	var running, peak int32
+	release := make(chan struct{})
+	bot.Register(blocking(release, &running, &peak, 2))
+	var waits []*sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		_, wg := bot.dispatch(PrivacyMessageEvent{})
+		waits = append(waits, wg)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for _, wg := range waits {
+		wg.Wait()
+	}
+	if peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak)
+	}
+}
+
+func TestWorkerPool_limitedHandlerDoesNotBlockWorkers(t *testing.T) {
+	bot := New(&Config{WorkerPool: WorkerPoolConfig{Enable: true, Workers: 2, QueueSize: 8}})
+	var running, peak, calls int32
+	release := make(chan struct{})
+	bot.Register(blocking(release, &running, &peak, 1))
+	bot.Register(counting(&calls))
+	var waits []*sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		_, wg := bot.dispatch(PrivacyMessageEvent{})
+		waits = append(waits, wg)
+	}
+	// 受限handler占用一个worker，其余事件由另一个worker处理，等待空位的handler不占用worker
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) != 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 4 {
+		t.Errorf("unrelated handler called %d times, want 4", calls)
+	}
+	close(release)
+	for _, wg := range waits {
+		wg.Wait()
+	}
+	if peak != 1 {
+		t.Errorf("peak concurrency = %d, want 1", peak)
+	}
+}
+
+func TestWorkerPool_limitedHandlerKeepsPriority(t *testing.T) {
+	bot := New(&Config{WorkerPool: WorkerPoolConfig{Enable: true, Workers: 2, QueueSize: 8}})
+	var high, low int32
+	release := make(chan struct{})
+	bot.Register(counting(&low))
+	bot.Register(limitedHandler{funcHandler: funcHandler{priority: 10, do: func(ctx *EventContext) {
+		<-release
+		atomic.AddInt32(&high, 1)
+		ctx.StopPropagation()
+	}}, limit: 1})
+	var waits []*sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		_, wg := bot.dispatch(PrivacyMessageEvent{})
+		waits = append(waits, wg)
+	}
+	deadline := time.Now().Add(time.Second)
+	for bot.PoolStats().Waiting != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// 等待空位的事件停在高优先级层，不占用worker
+	if stats := bot.PoolStats(); stats.Waiting != 3 || stats.Busy != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	close(release)
+	for _, wg := range waits {
+		wg.Wait()
+	}
+	if high != 4 || low != 0 {
+		t.Errorf("high = %d, low = %d, lower priority handler should not run after StopPropagation", high, low)
+	}
+}
+
+func TestWorkerPool_blockDoesNotStallActions(t *testing.T) {
+	// 模拟cq-http：先推送3条消息，再响应收到的action
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 3; i++ {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(groupMessageFrame))
+		}
+		for {
+			frame := actionFrame{}
+			if err := conn.ReadJSON(&frame); err != nil {
+				return
+			}
+			_ = conn.WriteJSON(map[string]interface{}{
+				"status":  "ok",
+				"retcode": 0,
+				"data":    map[string]int64{"message_id": 1},
+				"echo":    frame.Echo,
+			})
+		}
+	}))
+	defer server.Close()
+
+	bot := New(&Config{
+		ActionTransport: "ws",
+		ActionTimeout:   2 * time.Second,
+		WorkerPool:      WorkerPoolConfig{Enable: true, Workers: 1, QueueSize: 1, Overflow: OverflowBlock},
+	})
+	errs := make(chan error, 3)
+	bot.Register(funcHandler{do: func(ctx *EventContext) {
+		_, err := ctx.Send(NewMsgChain().AddText("pong"))
+		errs <- err
+	}})
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	bot.wsActions.setConn(conn)
+	go func() {
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			bot.onFrame(message)
+		}
+	}()
+	// 读取协程不等待队列空位，action响应照常送达；超出积压上限的事件被丢弃
+	received := 0
+	deadline := time.After(time.Second)
+	for received+int(bot.PoolStats().Dropped) < 3 {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+			received++
+		case <-deadline:
+			t.Fatal("action response not read while the queue is full")
+		}
+	}
+	if received == 0 {
+		t.Error("no event handled")
+	}
+}
+
+func TestWorkerPool_ingressBacklog(t *testing.T) {
+	bot := New(&Config{WorkerPool: WorkerPoolConfig{Enable: true, Workers: 1, QueueSize: 1}})
+	var running, peak int32
+	release := make(chan struct{})
+	bot.Register(blocking(release, &running, &peak, 0))
+	event := PrivacyMessageEvent{}
+	event.UserId = 1
+	_, wg := bot.dispatch(event)
+	for atomic.LoadInt32(&running) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	_, queued := bot.dispatch(event)
+	// ingress协程取出第一个事件后阻塞在已满的队列上，之后的事件在ingress中积压
+	bot.ingress.push(bot, event)
+	for bot.ingress.len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		bot.ingress.push(bot, event)
+	}
+	stats := bot.PoolStats()
+	if stats.Backlog != 1 || stats.QueueDepth != 1 || stats.Dropped != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+	close(release)
+	wg.Wait()
+	queued.Wait()
+	deadline := time.Now().Add(time.Second)
+	for bot.PoolStats().Processed != 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := bot.PoolStats(); stats.Processed != 4 || stats.Backlog != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
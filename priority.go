@@ -0,0 +1,107 @@
+package ranni
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PriorityHandler 可选接口，实现后按优先级从高到低分层执行handler，未实现时优先级为0。
+// 同一优先级的handler并发执行，某层中调用了EventContext.StopPropagation后不再执行更低优先级的handler
+type PriorityHandler interface {
+	Priority() int
+}
+
+func priorityOf(handler EventHandler) int {
+	if prioritized, ok := handler.(PriorityHandler); ok {
+		return prioritized.Priority()
+	}
+	return 0
+}
+
+// StopPropagation 标记事件已被处理，优先级更低的handler不再执行；同一优先级中的其他handler不受影响
+func (event *EventContext) StopPropagation() {
+	if event.stopped != nil {
+		atomic.StoreInt32(event.stopped, 1)
+	}
+}
+
+func (event *EventContext) propagationStopped() bool {
+	return event.stopped != nil && atomic.LoadInt32(event.stopped) == 1
+}
+
+// tiers 将handler按优先级从高到低分层，同一层内保持注册顺序
+func (bot *Bot) tiers() [][]*registeredHandler {
+	listeners := bot.listeners()
+	sort.SliceStable(listeners, func(i, j int) bool {
+		return listeners[i].priority > listeners[j].priority
+	})
+	var tiers [][]*registeredHandler
+	for i, registered := range listeners {
+		if i == 0 || registered.priority != listeners[i-1].priority {
+			tiers = append(tiers, nil)
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], registered)
+	}
+	return tiers
+}
+
+// runTiers 按优先级依次执行各层并等待结束，某层中的handler停止传播后不再执行后续层
+func (bot *Bot) runTiers(context *EventContext, tiers [][]*registeredHandler) {
+	for _, tier := range tiers {
+		tierWg := &sync.WaitGroup{}
+		ok := bot.runTier(context, tier, tierWg)
+		tierWg.Wait()
+		if !ok || context.propagationStopped() {
+			return
+		}
+	}
+}
+
+// runTier 并发执行一层handler，bot已停止时返回false
+func (bot *Bot) runTier(context *EventContext, tier []*registeredHandler, wg *sync.WaitGroup) bool {
+	for _, registered := range tier {
+		if !bot.acquire() {
+			return false
+		}
+		wg.Add(1)
+		go func(registered *registeredHandler) {
+			defer bot.running.Done()
+			defer wg.Done()
+			bot.handle(context, registered, false)
+		}(registered)
+	}
+	return true
+}
+
+// handle 执行单个handler，held为true时已取得并发空位。开启协程池且没有空位时返回false
+func (bot *Bot) handle(context *EventContext, registered *registeredHandler, held bool) bool {
+	if held {
+		defer bot.releaseSlot(registered)
+	}
+	registered.lock.RLock()
+	defer registered.lock.RUnlock()
+	if registered.removed || !bot.ready(registered) {
+		return true
+	}
+	if !registered.breaker.allow(time.Now()) || !bot.PluginEnabled(registered.id, context.GroupId, context.UserId) {
+		return true
+	}
+	if !held {
+		if !bot.acquireSlot(context, registered) {
+			return false
+		}
+		defer bot.releaseSlot(registered)
+	}
+	bot.invoke(context, registered)
+	return true
+}
+
+// invoke 以handler独立的上下文副本执行handler
+func (bot *Bot) invoke(context *EventContext, registered *registeredHandler) {
+	handlerCtx := context.fork(registered)
+	if err := bot.runHandler(registered, handlerCtx); err != nil {
+		bot.handlerFailed(registered, handlerCtx, err)
+	}
+}
@@ -0,0 +1,27 @@
+package ranni
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestBot_StopPropagation(t *testing.T) {
+	bot := New(&Config{})
+	var high, low, sibling int32
+	bot.Register(counting(&low))
+	bot.Register(funcHandler{priority: 10, do: func(ctx *EventContext) {
+		atomic.AddInt32(&high, 1)
+		ctx.StopPropagation()
+	}})
+	peer := counting(&sibling)
+	peer.priority = 10
+	bot.Register(peer)
+	_, wg := bot.dispatch(PrivacyMessageEvent{})
+	wg.Wait()
+	if high != 1 || sibling != 1 {
+		t.Errorf("high = %d, sibling = %d, handlers in the same tier should all run", high, sibling)
+	}
+	if low != 0 {
+		t.Error("lower priority handler ran after StopPropagation")
+	}
+}
@@ -0,0 +1,51 @@
+package ranni
+
+import "context"
+
+const (
+	OneBot11 = 11
+	OneBot12 = 12
+)
+
+// protocol OneBot协议适配，bot内部统一使用v11格式的事件与action
+type protocol interface {
+	// normalizeEvent 将推送的事件转换为v11格式
+	normalizeEvent(message []byte) ([]byte, error)
+	// action 将v11格式的action及参数转换为本协议的格式
+	action(ctx context.Context, action string, params interface{}) (string, interface{}, error)
+	// normalizeResponse 将action的响应转换为v11格式
+	normalizeResponse(action string, body []byte) ([]byte, error)
+}
+
+// oneBot11 v11协议，无需转换
+type oneBot11 struct {
+}
+
+func (oneBot11) normalizeEvent(message []byte) ([]byte, error) {
+	return message, nil
+}
+
+func (oneBot11) action(ctx context.Context, action string, params interface{}) (string, interface{}, error) {
+	return action, params, nil
+}
+
+func (oneBot11) normalizeResponse(action string, body []byte) ([]byte, error) {
+	return body, nil
+}
+
+// protocol 返回当前配置的协议版本
+func (bot *Bot) protocol() protocol {
+	if bot.config.ProtocolVersion == OneBot12 {
+		return oneBot12{bot: bot}
+	}
+	return oneBot11{}
+}
+
+// decodeEvent 按协议版本解析推送的事件
+func (bot *Bot) decodeEvent(message []byte) (Event, error) {
+	normalized, err := bot.protocol().normalizeEvent(message)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEvent(normalized)
+}
@@ -0,0 +1,149 @@
+package ranni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerWindow   = time.Minute
+	defaultBreakerCooldown = 10 * time.Minute
+)
+
+// PanicError handler或定时任务panic时捕获的值及调用栈
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", err.Value)
+}
+
+// ErrorHandler handler或定时任务出错时的回调，定时任务出错时ctx为nil
+type ErrorHandler func(ctx *EventContext, err error)
+
+// circuitBreaker 统计handler在时间窗口内的panic次数，达到阈值后暂停handler
+type circuitBreaker struct {
+	sync.Mutex
+	failures  []time.Time
+	openUntil time.Time
+}
+
+// allow handler是否处于可用状态
+func (breaker *circuitBreaker) allow(now time.Time) bool {
+	breaker.Lock()
+	defer breaker.Unlock()
+	return !now.Before(breaker.openUntil)
+}
+
+// fail 记录一次失败，达到阈值时暂停handler并返回true
+func (breaker *circuitBreaker) fail(now time.Time, threshold int, window, cooldown time.Duration) bool {
+	breaker.Lock()
+	defer breaker.Unlock()
+	recent := breaker.failures[:0]
+	for _, failure := range breaker.failures {
+		if now.Sub(failure) < window {
+			recent = append(recent, failure)
+		}
+	}
+	breaker.failures = append(recent, now)
+	if len(breaker.failures) < threshold {
+		return false
+	}
+	breaker.failures = nil
+	breaker.openUntil = now.Add(cooldown)
+	return true
+}
+
+func OnError(handler ErrorHandler) {
+	engine.OnError(handler)
+}
+
+// OnError 注册错误回调，handler或定时任务panic、中间件返回错误时调用；未注册时输出到日志
+func (bot *Bot) OnError(handler ErrorHandler) {
+	bot.errorHandlers = append(bot.errorHandlers, handler)
+}
+
+// runHandler 执行handler的Filter及中间件链，捕获其中的panic
+func (bot *Bot) runHandler(registered *registeredHandler, ctx *EventContext) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	if !registered.handler.Filter(ctx) {
+		return nil
+	}
+	return bot.chain(registered)(ctx)
+}
+
+// recoverDo 执行handler的Do，panic转换为PanicError交给外层中间件
+func recoverDo(handler EventHandler, ctx *EventContext) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	handler.Do(ctx)
+	return nil
+}
+
+// handlerFailed 上报handler错误，panic计入熔断统计
+func (bot *Bot) handlerFailed(registered *registeredHandler, ctx *EventContext, err error) {
+	bot.reportError(ctx, err)
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || bot.config.BreakerThreshold <= 0 {
+		return
+	}
+	config := bot.config
+	if registered.breaker.fail(time.Now(), config.BreakerThreshold, config.breakerWindow(), config.breakerCooldown()) {
+		bot.notifyAdmins(fmt.Sprintf("handler %s 在%s内panic %d次，已暂停%s\n最近一次：%v",
+			registered.id, config.breakerWindow(), config.BreakerThreshold, config.breakerCooldown(), panicErr.Value))
+	}
+}
+
+func (bot *Bot) reportError(ctx *EventContext, err error) {
+	if len(bot.errorHandlers) == 0 {
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			log.Printf("%v\n%s", err, panicErr.Stack)
+		} else {
+			log.Println(err)
+		}
+		return
+	}
+	for _, handler := range bot.errorHandlers {
+		handler(ctx, err)
+	}
+}
+
+// recoverCron 包装定时任务，panic时上报错误而不是使进程退出
+func (bot *Bot) recoverCron(cronStr string, cmd func()) func() {
+	return func() {
+		defer func() {
+			if r := recover(); r != nil {
+				bot.reportError(nil, fmt.Errorf("定时任务%s执行失败：%w", cronStr, &PanicError{Value: r, Stack: debug.Stack()}))
+			}
+		}()
+		cmd()
+	}
+}
+
+// notifyAdmins 私聊通知Config.Admins中的管理员
+func (bot *Bot) notifyAdmins(text string) {
+	log.Println(text)
+	for _, admin := range bot.config.Admins {
+		ctx, cancel := context.WithTimeout(bot.baseCtx, bot.config.actionTimeout())
+		_, err := bot.SendToPrivacyContext(ctx, admin, InitMsgChain(TextMessage{Text: text}))
+		cancel()
+		if err != nil {
+			log.Println("通知管理员失败：", admin, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package ranni
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBot_handlerPanic(t *testing.T) {
+	bot := New(&Config{BreakerThreshold: 2})
+	var calls int32
+	var lock sync.Mutex
+	var errs []error
+	bot.OnError(func(ctx *EventContext, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		errs = append(errs, err)
+	})
+	bot.Register(funcHandler{do: func(ctx *EventContext) {
+		atomic.AddInt32(&calls, 1)
+		panic("boom")
+	}})
+	for i := 0; i < 3; i++ {
+		_, wg := bot.dispatch(PrivacyMessageEvent{})
+		wg.Wait()
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2 before breaker opens", calls)
+	}
+	var panicErr *PanicError
+	if len(errs) != 2 || !errors.As(errs[0], &panicErr) || len(panicErr.Stack) == 0 {
+		t.Errorf("errors = %v", errs)
+	}
+
+	bot.recoverCron("@every 1s", func() { panic("cron") })()
+	if len(errs) != 3 || !errors.As(errs[2], &panicErr) || panicErr.Value != "cron" {
+		t.Errorf("cron error = %v", errs)
+	}
+}
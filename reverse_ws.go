@@ -0,0 +1,117 @@
+package ranni
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultReverseWsPath = "/onebot/v11/ws"
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// reverseConnections 当前已接入的反向ws连接
+type reverseConnections struct {
+	sync.Mutex
+	conns map[*websocket.Conn]string
+}
+
+func (connections *reverseConnections) add(conn *websocket.Conn, selfId string) {
+	connections.Lock()
+	defer connections.Unlock()
+	if connections.conns == nil {
+		connections.conns = make(map[*websocket.Conn]string)
+	}
+	connections.conns[conn] = selfId
+}
+
+func (connections *reverseConnections) remove(conn *websocket.Conn) {
+	connections.Lock()
+	defer connections.Unlock()
+	delete(connections.conns, conn)
+}
+
+func (connections *reverseConnections) closeAll() {
+	connections.Lock()
+	defer connections.Unlock()
+	for conn := range connections.conns {
+		err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		if err != nil {
+			log.Println("write close:", err)
+		}
+		_ = conn.Close()
+	}
+}
+
+func (bot *Bot) reverseWsHandler(ctx *gin.Context) {
+	if !bot.checkAccessToken(ctx.Request) {
+		NoAuth(ctx, "access token错误")
+		return
+	}
+	role := ctx.GetHeader("X-Client-Role")
+	switch role {
+	case "", "Universal", "Event", "API":
+	default:
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, Result{Msg: "不支持的X-Client-Role：" + role})
+		return
+	}
+	selfId := ctx.GetHeader("X-Self-ID")
+	var header http.Header
+	if subprotocol := ctx.GetHeader("Sec-WebSocket-Protocol"); strings.HasPrefix(subprotocol, "12.") {
+		// OneBot 12要求回应实现所声明的子协议
+		header = http.Header{}
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, header)
+	if err != nil {
+		log.Println("反向ws升级失败：", err)
+		return
+	}
+	log.Printf("bot %s 已通过反向ws接入，role: %s", selfId, role)
+	bot.reverseConns.add(conn, selfId)
+	if role != "Event" {
+		bot.wsActions.setConn(conn)
+	}
+	bot.notifyState(Connected, nil)
+	defer func() {
+		bot.wsActions.clearConn(conn)
+		bot.reverseConns.remove(conn)
+		_ = conn.Close()
+	}()
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			log.Println("read:", err)
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				err = nil
+			}
+			bot.notifyState(Disconnected, err)
+			return
+		}
+		bot.onFrame(message)
+	}
+}
+
+// checkAccessToken 校验请求头Authorization或query中的access_token
+func (bot *Bot) checkAccessToken(r *http.Request) bool {
+	if bot.config.AccessToken == "" {
+		return true
+	}
+	token := r.URL.Query().Get("access_token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token = strings.TrimSpace(auth)
+		for _, prefix := range []string{"Bearer ", "Token "} {
+			token = strings.TrimPrefix(token, prefix)
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(bot.config.AccessToken)) == 1
+}
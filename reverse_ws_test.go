@@ -0,0 +1,22 @@
+package ranni
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBot_reverseWsHandler_role(t *testing.T) {
+	bot := New(&Config{ReverseWs: true})
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.GET("/", bot.reverseWsHandler)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Client-Role", "Unknown")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unsupported role: expect 400, got %d", w.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package ranni
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -8,71 +9,179 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	"github.com/robfig/cron/v3"
 	"log"
-	"net/url"
-	"os"
-	"os/signal"
+	"net"
+	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var engine = &robotEngine{
-	cronClient: cron.New(),
-}
+// engine 默认bot，供包级别的Start、Register等函数使用
+var engine = New(nil)
 
-type robotEngine struct {
+// Bot 一个QQ账号对应的机器人实例，各实例拥有独立的handler、定时任务、连接与配置
+type Bot struct {
 	HelpNotice     string
-	innerListeners []EventHandler
+	config         *Config
+	innerListeners []*registeredHandler
+	listenersLock  sync.RWMutex
+	connected      int32 // 首次连接成功后置为1
+	middlewares    []Middleware
+	errorHandlers  []ErrorHandler
+	conversations  conversations
+	pool           workerPool
+	ordered        orderedDispatcher
+	ingress        frameIngress
+	store          Store
+	storeLock      sync.Mutex
+	limits         *MemoryStore // 未开启Persist的冷却与配额计数
+	limitLock      sync.Mutex   // 保证读取与更新计数的原子性
 	cronClient     *cron.Cron
+	stateHandlers  []ConnectionStateHandler
+	reverseConns   reverseConnections
+	wsActions      wsTransport
+	ids12          idTable // v12非数字ID的映射
+	heartbeat      heartbeatWatchdog
+	sendQueue      sendQueue
+	net            network
+	servers        []*http.Server
+	runLock        sync.RWMutex
+	running        sync.WaitGroup // 执行中的handler
+	stopped        bool
+	done           chan struct{} // 停止时关闭，通知连接退出
+	loopDone       chan struct{} // 连接循环退出时关闭
+	baseCtx        context.Context
+	cancelBase     context.CancelFunc // 停止等待超时后取消，中断执行中handler的调用
+}
+
+// New 创建一个bot实例
+func New(config *Config) *Bot {
+	bot := &Bot{
+		config:     config,
+		cronClient: cron.New(),
+		done:       make(chan struct{}),
+		limits:     NewMemoryStore(),
+	}
+	bot.baseCtx, bot.cancelBase = context.WithCancel(context.Background())
+	bot.wsActions.bot = bot
+	bot.sendQueue.bot = bot
+	return bot
 }
 
 func Start(config *Config) {
-	engine.Start(config)
+	engine.config = config
+	engine.Start()
 }
 
-func Register(handler EventHandler) {
-	engine.Register(handler)
+func Register(handler EventHandler, middlewares ...Middleware) {
+	engine.Register(handler, middlewares...)
 }
 
 func RegisterCron(cronStr string, cmd func()) {
 	engine.RegisterCron(cronStr, cmd)
 }
 
-var robotConfig *Config
+// Config 返回bot的配置
+func (bot *Bot) Config() *Config {
+	return bot.config
+}
 
-func (robotEngine *robotEngine) Start(config *Config) {
-	robotConfig = config
-	//启动定时器
-	robotEngine.cronClient.Start()
-	//启动web服务
-	if robotConfig.ApiAddr != "" {
-		go startApiServer()
+// transport 返回当前配置的action调用通道
+func (bot *Bot) transport() Transport {
+	if bot.config.ActionTransport == WsTransport {
+		return &bot.wsActions
 	}
-	//连接cq-http
-	cqConnect()
+	return httpTransport{bot: bot}
 }
 
-func startApiServer() {
-	e := gin.Default()
-	e.POST("/send", ApiSendMessage)
-	err := e.Run(robotConfig.ApiAddr)
-	if err != nil {
-		log.Println("api服务启动失败！", err)
+// startServers 启动API、反向ws及http post所需的web服务，监听地址相同的路由挂载在同一个服务上
+func (bot *Bot) startServers() {
+	servers := make(map[string]*gin.Engine)
+	route := func(addr string, name string) *gin.Engine {
+		if addr == "" {
+			addr = bot.config.ApiAddr
+		}
+		if addr == "" {
+			log.Printf("%s未配置监听地址，且未配置ApiAddr", name)
+			return nil
+		}
+		if servers[addr] == nil {
+			servers[addr] = gin.Default()
+		}
+		return servers[addr]
+	}
+	if bot.config.ApiAddr != "" {
+		route(bot.config.ApiAddr, "api").POST("/send", bot.ApiSendMessage)
+	}
+	if bot.config.ReverseWs {
+		if e := route(bot.config.ReverseWsAddr, "反向ws"); e != nil {
+			e.GET(bot.config.reverseWsPath(), bot.reverseWsHandler)
+		}
+	}
+	var httpPost *gin.Engine
+	if bot.config.HttpPost {
+		if httpPost = route(bot.config.HttpPostAddr, "http post"); httpPost != nil {
+			httpPost.POST(bot.config.httpPostPath(), bot.httpPostHandler)
+		}
+	}
+	for addr, e := range servers {
+		server := &http.Server{Addr: addr, Handler: e}
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Println("web服务启动失败！", addr, err)
+			continue
+		}
+		bot.servers = append(bot.servers, server)
+		// http post模式没有连接，开始监听即视为连接成功，在接收事件前初始化handler
+		if e == httpPost {
+			bot.initHandlers()
+		}
+		go func(server *http.Server) {
+			err := server.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
+				log.Println("web服务异常退出！", server.Addr, err)
+			}
+		}(server)
 	}
 }
 
-func cqConnect() {
-	u := url.URL{Scheme: "ws", Host: robotConfig.WsAddr}
-	values := url.Values{}
-	values.Add("access_token", robotConfig.AccessToken)
-	u.RawQuery = values.Encode()
-	log.Printf("connecting to %s", robotConfig.WsAddr)
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
-	client, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+func (bot *Bot) cqConnect() {
+	_, dialer, err := bot.network()
+	if err != nil {
+		log.Println("网络配置错误：", err)
+		return
+	}
+	u, err := bot.config.wsUrl()
 	if err != nil {
-		panic(err.Error())
+		log.Println("ws地址错误：", err)
 		return
 	}
+	retries := 0
+	for {
+		log.Printf("connecting to %s", bot.config.WsAddr)
+		client, _, err := dialer.Dial(u.String(), bot.config.authHeader())
+		if err != nil {
+			log.Println("连接cq-http失败：", err)
+			if !bot.waitReconnect(&retries, err) {
+				return
+			}
+			continue
+		}
+		retries = 0
+		bot.wsActions.setConn(client)
+		bot.notifyState(Connected, nil)
+		err = bot.serveConn(client)
+		bot.wsActions.clearConn(client)
+		bot.notifyState(Disconnected, err)
+		if err == nil || !bot.waitReconnect(&retries, err) {
+			return
+		}
+	}
+}
+
+// serveConn 读取连接中的事件直到连接断开，bot停止时关闭连接并返回nil
+func (bot *Bot) serveConn(client *websocket.Conn) error {
 	defer func(client *websocket.Conn) {
 		err := client.Close()
 		if err != nil {
@@ -80,100 +189,263 @@ func cqConnect() {
 		}
 	}(client)
 	done := make(chan struct{})
+	var readErr error
 	go func() {
 		defer close(done)
 		for {
 			_, message, err := client.ReadMessage()
 			if err != nil {
 				log.Println("read:", err)
+				readErr = err
 				return
 			}
-			go func() {
-				if jsoniter.Valid(message) {
-					msgEvent := BaseEvent{}
-					if err := jsoniter.Unmarshal(message, &msgEvent); err == nil {
-						switch msgEvent.PostType {
-						case "message":
-							if event, err := messageEventDecode(message); err == nil {
-								engine.CallEvent(event)
-							}
-						}
-					}
-				}
-			}()
+			bot.onFrame(message)
 		}
 	}()
-	for {
+	select {
+	case <-done:
+		return readErr
+	case <-bot.done:
+		err := client.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		if err != nil {
+			log.Println("write close:", err)
+			return nil
+		}
 		select {
 		case <-done:
-			return
-		case <-interrupt:
-			log.Println("interrupt")
-			err := client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-			if err != nil {
-				log.Println("write close:", err)
-				return
-			}
-			select {
-			case <-done:
-			case <-time.After(time.Second):
-			}
-			return
+		case <-time.After(time.Second):
 		}
+		return nil
+	}
+}
+
+// handleFrame 解析并分发一帧事件，action响应已由onFrame处理
+func (bot *Bot) handleFrame(message []byte) {
+	if event, err := bot.decodeEvent(message); err == nil {
+		bot.CallEvent(event)
+	}
+}
+
+// decodeEvent 解析cq-http推送的事件，不支持的事件类型返回错误
+func decodeEvent(message []byte) (Event, error) {
+	if !jsoniter.Valid(message) {
+		return nil, errors.New("事件内容不是合法的json")
+	}
+	msgEvent := BaseEvent{}
+	if err := jsoniter.Unmarshal(message, &msgEvent); err != nil {
+		return nil, err
+	}
+	switch msgEvent.PostType {
+	case "message":
+		return messageEventDecode(message)
+	case "notice":
+		return noticeEventDecode(message)
+	case "request":
+		return requestEventDecode(message)
+	case "meta_event":
+		return metaEventDecode(message)
+	default:
+		return nil, fmt.Errorf("不支持的事件类型：%s", msgEvent.PostType)
+	}
+}
+
+// waitReconnect 按退避策略等待下一次重连，超过最大重连次数或bot停止时返回false
+func (bot *Bot) waitReconnect(retries *int, cause error) bool {
+	if bot.config.ReconnectMaxRetries > 0 && *retries >= bot.config.ReconnectMaxRetries {
+		log.Printf("重连%d次仍失败，停止重连", *retries)
+		return false
+	}
+	delay := backoffDelay(*retries, bot.config.reconnectInterval(), bot.config.reconnectMaxInterval())
+	*retries++
+	bot.notifyState(Reconnecting, cause)
+	log.Printf("%v后进行第%d次重连", delay, *retries)
+	select {
+	case <-time.After(delay):
+		return true
+	case <-bot.done:
+		return false
 	}
 }
 
+func (bot *Bot) notifyState(state ConnectionState, err error) {
+	if state == Connected {
+		bot.initHandlers()
+	}
+	for _, handler := range bot.stateHandlers {
+		handler(state, err)
+	}
+}
+
+// OnConnectionStateChange 注册连接状态变化回调
+func OnConnectionStateChange(handler ConnectionStateHandler) {
+	engine.OnConnectionStateChange(handler)
+}
+
+func (bot *Bot) OnConnectionStateChange(handler ConnectionStateHandler) {
+	bot.stateHandlers = append(bot.stateHandlers, handler)
+}
+
 func HelpNotice() string {
+	engine.listenersLock.RLock()
+	defer engine.listenersLock.RUnlock()
 	return engine.HelpNotice
 }
 
-func (robotEngine *robotEngine) Register(listener EventHandler) {
-	if len(robotEngine.HelpNotice) == 0 {
-		robotEngine.HelpNotice = "使 用 指 南\n"
+// Register 注册handler，middlewares仅对该handler生效
+func (bot *Bot) Register(listener EventHandler, middlewares ...Middleware) {
+	registered := &registeredHandler{
+		handler:     listener,
+		help:        bot.helpOf(listener),
+		middlewares: middlewares,
+		priority:    priorityOf(listener),
+	}
+	bot.listenersLock.Lock()
+	registered.id = uniqueId(bot.innerListeners, handlerId(listener))
+	bot.innerListeners = append(bot.innerListeners, registered)
+	bot.refreshHelp()
+	bot.listenersLock.Unlock()
+	if atomic.LoadInt32(&bot.connected) == 1 {
+		go bot.initRegistered(registered)
 	}
-	robotEngine.HelpNotice = robotEngine.HelpNotice + "\n" + listener.Help()
-	if robotEngine.innerListeners == nil {
-		robotEngine.innerListeners = make([]EventHandler, 0)
+}
+
+// helpOf 获取handler的帮助信息，命令使用bot配置的前缀生成用法
+func (bot *Bot) helpOf(listener EventHandler) string {
+	if command, ok := listener.(*Command); ok {
+		return command.Usage(bot.commandPrefixes()[0])
 	}
-	robotEngine.innerListeners = append(robotEngine.innerListeners, listener)
+	return listener.Help()
 }
 
-func (robotEngine *robotEngine) RegisterCron(cronStr string, cmd func()) {
-	_, err := robotEngine.cronClient.AddFunc(cronStr, cmd)
+func (bot *Bot) RegisterCron(cronStr string, cmd func()) {
+	_, err := bot.cronClient.AddFunc(cronStr, bot.recoverCron(cronStr, cmd))
 	if err != nil {
 		log.Println(err.Error())
 		log.Panicln("定时任务添加异常")
 	}
 }
 
-func (robotEngine *robotEngine) CallEvent(event Event) {
+func (bot *Bot) CallEvent(event Event) {
+	bot.dispatch(event)
+}
+
+// consume 处理由bot自身消费的事件，返回true时不再分发给handler
+func (bot *Bot) consume(event Event) bool {
+	switch e := event.(type) {
+	case HeartbeatMetaEvent:
+		bot.onHeartbeat(e)
+		return true
+	case StatusUpdateMetaEvent:
+		bot.onStatusUpdate(e)
+	case LifecycleMetaEvent:
+		log.Printf("bot %d lifecycle: %s", e.SelfId, e.SubType)
+	}
+	return false
+}
+
+// dispatch 将事件分发给所有handler，返回的WaitGroup在所有handler执行完毕后结束
+func (bot *Bot) dispatch(event Event) (*EventContext, *sync.WaitGroup) {
+	context := bot.newEventContext(event)
+	wg := &sync.WaitGroup{}
+	if bot.consume(event) {
+		context.cancel()
+		return context, wg
+	}
+	if bot.conversations.intercept(context) {
+		return context, wg
+	}
+	// 由协程池或会话队列执行全部handler，被丢弃时直接结束
+	run := &eventRun{bot: bot, context: context, wg: wg}
+	if key, ok := subjectOf(context); ok && bot.orderedEnabled() {
+		wg.Add(1)
+		bot.ordered.enqueue(bot, key, run)
+		return context, wg
+	}
+	if bot.poolEnabled() {
+		wg.Add(1)
+		bot.pool.submit(bot, run.job())
+		return context, wg
+	}
+	tiers := bot.tiers()
+	if len(tiers) == 1 {
+		bot.runTier(context, tiers[0], wg)
+	} else if len(tiers) > 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bot.runTiers(context, tiers)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		context.cancel()
+	}()
+	return context, wg
+}
+
+// newEventContext 根据事件内容填充上下文
+func (bot *Bot) newEventContext(event Event) *EventContext {
 	context := &EventContext{}
+	context.Bot = bot
 	context.OriginalEvent = event
+	context.EventType = event.EventType()
 	context.Values = make(map[string]interface{})
-	if event.EventType() == GroupMessageEventType {
-		messageEvent := event.(GroupMessageEvent)
-		context.GroupId = messageEvent.GroupId
-		context.UserId = messageEvent.Sender.UserId
-		context.EventType = GroupMessageEventType
-		context.SelfId = messageEvent.SelfId
-		context.Sender = messageEvent.Sender
-		context.MessageChain = &messageEvent.MessageChain
-	}
-	if event.EventType() == PrivacyMessageEventType {
-		messageEvent := event.(PrivacyMessageEvent)
-		context.UserId = messageEvent.UserId
-		context.EventType = PrivacyMessageEventType
-		context.SelfId = messageEvent.SelfId
-		context.Sender = messageEvent.Sender
-		context.MessageChain = &messageEvent.MessageChain
-	}
-	for _, callBack := range robotEngine.innerListeners {
-		go func(callBack EventHandler) {
-			if callBack.Filter(context) {
-				callBack.Do(context)
-			}
-		}(callBack)
+	context.MessageChain = &MessageChain{}
+	context.quick = &quickOperation{}
+	context.stopped = new(int32)
+	context.ctx, context.cancel = bot.eventCtx()
+	switch e := event.(type) {
+	case GroupMessageEvent:
+		context.GroupId = e.GroupId
+		context.UserId = e.Sender.UserId
+		context.SelfId = e.SelfId
+		context.Sender = e.Sender
+		context.MessageChain = &e.MessageChain
+	case PrivacyMessageEvent:
+		context.UserId = e.UserId
+		context.SelfId = e.SelfId
+		context.Sender = e.Sender
+		context.MessageChain = &e.MessageChain
+	case GroupUploadNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+	case GroupAdminNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+	case GroupDecreaseNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+		context.OperatorId = e.OperatorId
+	case GroupIncreaseNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+		context.OperatorId = e.OperatorId
+	case GroupBanNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+		context.OperatorId = e.OperatorId
+	case FriendAddNoticeEvent:
+		context.SelfId, context.UserId = e.SelfId, e.UserId
+	case GroupRecallNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+		context.OperatorId = e.OperatorId
+	case FriendRecallNoticeEvent:
+		context.SelfId, context.UserId = e.SelfId, e.UserId
+	case PokeNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+		context.TargetId = e.TargetId
+	case LuckyKingNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+		context.TargetId = e.TargetId
+	case HonorNoticeEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+	case FriendRequestEvent:
+		context.SelfId, context.UserId = e.SelfId, e.UserId
+	case GroupRequestEvent:
+		context.SelfId, context.GroupId, context.UserId = e.SelfId, e.GroupId, e.UserId
+	case LifecycleMetaEvent:
+		context.SelfId = e.SelfId
+	case HeartbeatMetaEvent:
+		context.SelfId = e.SelfId
+	case StatusUpdateMetaEvent:
+		context.SelfId = e.SelfId
 	}
+	return context
 }
 
 func messageEventDecode(post []byte) (event Event, err error) {
@@ -201,6 +473,112 @@ func messageEventDecode(post []byte) (event Event, err error) {
 	return event, nil
 }
 
+func noticeEventDecode(post []byte) (event Event, err error) {
+	noticeType := jsoniter.Get(post, "notice_type").ToString()
+	if noticeType == "notify" {
+		noticeType = jsoniter.Get(post, "sub_type").ToString()
+	}
+	switch noticeType {
+	case "group_upload":
+		p := &GroupUploadNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "group_admin":
+		p := &GroupAdminNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "group_decrease":
+		p := &GroupDecreaseNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "group_increase":
+		p := &GroupIncreaseNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "group_ban":
+		p := &GroupBanNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "friend_add":
+		p := &FriendAddNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "group_recall":
+		p := &GroupRecallNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "friend_recall":
+		p := &FriendRecallNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "poke":
+		p := &PokeNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "lucky_king":
+		p := &LuckyKingNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "honor":
+		p := &HonorNoticeEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	default:
+		return nil, errors.New("未知的通知类型：" + noticeType)
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("解析事件内容错误！")
+	}
+	return event, nil
+}
+
+func requestEventDecode(post []byte) (event Event, err error) {
+	requestType := jsoniter.Get(post, "request_type").ToString()
+	switch requestType {
+	case "friend":
+		p := &FriendRequestEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "group":
+		p := &GroupRequestEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	default:
+		return nil, errors.New("未知的请求类型：" + requestType)
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("解析事件内容错误！")
+	}
+	return event, nil
+}
+
+func metaEventDecode(post []byte) (event Event, err error) {
+	metaEventType := jsoniter.Get(post, "meta_event_type").ToString()
+	switch metaEventType {
+	case "lifecycle":
+		p := &LifecycleMetaEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "heartbeat":
+		p := &HeartbeatMetaEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	case "status_update":
+		p := &StatusUpdateMetaEvent{}
+		err = jsoniter.Unmarshal(post, p)
+		event = *p
+	default:
+		return nil, errors.New("未知的元事件类型：" + metaEventType)
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, errors.New("解析事件内容错误！")
+	}
+	return event, nil
+}
+
 func JsonToMessageChain(messages jsoniter.Any) MessageChain {
 	var msgS []Message
 	for i := 0; i < messages.Size(); i++ {
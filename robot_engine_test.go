@@ -1,16 +1,123 @@
 package ranni
 
 import (
+	"context"
+	"os"
 	"testing"
 	"time"
 )
 
+// 需要真实的cq-http，通过RANNI_WS_ADDR指定ws地址后运行
 func Test_robotEngine_Start(t *testing.T) {
+	wsAddr := os.Getenv("RANNI_WS_ADDR")
+	if wsAddr == "" {
+		t.Skip("RANNI_WS_ADDR未设置")
+	}
 	Start(&Config{
-		WsAddr:       "",
+		WsAddr:       wsAddr,
 		CallBackAddr: "",
 		AccessToken:  "",
 		ApiAddr:      ":8999",
 	})
 	time.Sleep(100000 * time.Second)
 }
+
+func Test_backoffDelay(t *testing.T) {
+	base, max := time.Second, time.Minute
+	for attempt := 0; attempt < 40; attempt++ {
+		expect := max
+		if attempt < 6 {
+			expect = base << uint(attempt)
+		}
+		delay := backoffDelay(attempt, base, max)
+		if delay < expect/2 || delay > expect {
+			t.Fatalf("attempt %d: delay %v not in [%v, %v]", attempt, delay, expect/2, expect)
+		}
+	}
+}
+
+func TestBot_Stop(t *testing.T) {
+	bot := New(&Config{})
+	done := make(chan struct{})
+	bot.Register(funcHandler{do: func(ctx *EventContext) {
+		time.Sleep(100 * time.Millisecond)
+		close(done)
+	}})
+	bot.CallEvent(PrivacyMessageEvent{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bot.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("Stop returned before handler finished")
+	}
+	// 停止后不再分发事件，重复关闭done会panic
+	bot.CallEvent(PrivacyMessageEvent{})
+}
+
+func Test_decodeEvent_notice(t *testing.T) {
+	tests := []struct {
+		frame     string
+		eventType EventType
+		subjectId int64
+	}{
+		{`{"post_type":"notice","notice_type":"group_increase","sub_type":"approve","group_id":1,"operator_id":2,"user_id":3}`, GroupIncreaseNoticeEventType, 1},
+		{`{"post_type":"notice","notice_type":"friend_recall","user_id":3,"message_id":4}`, FriendRecallNoticeEventType, 3},
+		{`{"post_type":"notice","notice_type":"notify","sub_type":"poke","group_id":1,"user_id":3,"target_id":5}`, PokeNoticeEventType, 1},
+		{`{"post_type":"notice","notice_type":"notify","sub_type":"honor","group_id":1,"user_id":3,"honor_type":"talkative"}`, HonorNoticeEventType, 1},
+	}
+	bot := New(&Config{})
+	for _, test := range tests {
+		event, err := decodeEvent([]byte(test.frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := bot.newEventContext(event)
+		if ctx.EventType != test.eventType || ctx.GetSubjectId() != test.subjectId {
+			t.Fatalf("%s: got type %v subject %d", test.frame, ctx.EventType, ctx.GetSubjectId())
+		}
+	}
+}
+
+func TestBot_heartbeatTimeout(t *testing.T) {
+	bot := New(&Config{HeartbeatTimeout: 50 * time.Millisecond})
+	timeout := make(chan HeartbeatMetaEvent, 1)
+	bot.OnHeartbeatTimeout(func(last HeartbeatMetaEvent) {
+		timeout <- last
+	})
+	event, err := decodeEvent([]byte(`{"post_type":"meta_event","meta_event_type":"heartbeat","self_id":1,` +
+		`"interval":5000,"status":{"online":true,"good":true,"stat":{"message_received":3}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.CallEvent(event)
+	last, ok := bot.LastHeartbeat()
+	if !ok || !last.Status.Online || last.Status.Stat.MessageReceived != 3 {
+		t.Fatalf("unexpected heartbeat %+v", last)
+	}
+	select {
+	case <-timeout:
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat timeout not triggered")
+	}
+}
+
+func TestEventContext_Context(t *testing.T) {
+	bot := New(&Config{HandlerTimeout: 20 * time.Millisecond})
+	errs := make(chan error, 1)
+	bot.Register(funcHandler{do: func(ctx *EventContext) {
+		select {
+		case <-ctx.Context().Done():
+			errs <- ctx.Context().Err()
+		case <-time.After(time.Second):
+			errs <- nil
+		}
+	}})
+	bot.CallEvent(PrivacyMessageEvent{})
+	if err := <-errs; err != context.DeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package ranni
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig 消息发送限速配置，速率单位为条/秒
+type RateLimitConfig struct {
+	Enable      bool    `yaml:"enable"`
+	GlobalRate  float64 `yaml:"global_rate"`  // 所有会话合计的发送速率，小于等于0时不限制
+	GlobalBurst int     `yaml:"global_burst"` // 全局允许的突发条数，默认1
+	TargetRate  float64 `yaml:"target_rate"`  // 单个群/用户的发送速率，小于等于0时不限制
+	TargetBurst int     `yaml:"target_burst"` // 单个群/用户允许的突发条数，默认1
+}
+
+// SendFuture 异步发送的结果
+type SendFuture struct {
+	done chan struct{}
+	back *MessageCallBack
+	err  error
+}
+
+func newSendFuture() *SendFuture {
+	return &SendFuture{done: make(chan struct{})}
+}
+
+func (future *SendFuture) resolve(back *MessageCallBack, err error) {
+	future.back, future.err = back, err
+	close(future.done)
+}
+
+// Wait 等待消息发送完成
+func (future *SendFuture) Wait() (*MessageCallBack, error) {
+	<-future.done
+	return future.back, future.err
+}
+
+// WaitContext 等待消息发送完成，ctx结束时不再等待
+func (future *SendFuture) WaitContext(ctx context.Context) (*MessageCallBack, error) {
+	select {
+	case <-future.done:
+		return future.back, future.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done 消息发送完成后关闭
+func (future *SendFuture) Done() <-chan struct{} {
+	return future.done
+}
+
+// tokenBucket 令牌桶，rate小于等于0时不限制
+type tokenBucket struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (bucket *tokenBucket) refill() {
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.last = now
+}
+
+// reserve 取走一个令牌，返回需要等待的时间
+func (bucket *tokenBucket) reserve() time.Duration {
+	if bucket.rate <= 0 {
+		return 0
+	}
+	bucket.Lock()
+	defer bucket.Unlock()
+	bucket.refill()
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// untilFull 令牌恢复满还需等待的时间，已满时返回0
+func (bucket *tokenBucket) untilFull() time.Duration {
+	if bucket.rate <= 0 {
+		return 0
+	}
+	bucket.Lock()
+	defer bucket.Unlock()
+	bucket.refill()
+	if bucket.tokens >= bucket.burst {
+		return 0
+	}
+	return time.Duration((bucket.burst - bucket.tokens) / bucket.rate * float64(time.Second))
+}
+
+func (bucket *tokenBucket) wait(ctx context.Context) error {
+	delay := bucket.reserve()
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type sendTask struct {
+	ctx    context.Context
+	call   func() (*MessageCallBack, error)
+	future *SendFuture
+}
+
+// targetQueue 单个会话的发送队列，由一个goroutine按顺序发送，队列为空时退出
+type targetQueue struct {
+	bucket  *tokenBucket
+	pending []*sendTask
+	running bool
+}
+
+// sendQueue 按会话排队并限速的发送器
+type sendQueue struct {
+	sync.Mutex
+	bot     *Bot
+	global  *tokenBucket
+	targets map[string]*targetQueue
+}
+
+func (queue *sendQueue) submit(ctx context.Context, key string, call func() (*MessageCallBack, error)) *SendFuture {
+	task := &sendTask{ctx: ctx, call: call, future: newSendFuture()}
+	config := queue.bot.config.RateLimit
+	queue.Lock()
+	defer queue.Unlock()
+	if queue.global == nil {
+		queue.global = newTokenBucket(config.GlobalRate, config.GlobalBurst)
+		queue.targets = make(map[string]*targetQueue)
+	}
+	target := queue.targets[key]
+	if target == nil {
+		target = &targetQueue{bucket: newTokenBucket(config.TargetRate, config.TargetBurst)}
+		queue.targets[key] = target
+	}
+	target.pending = append(target.pending, task)
+	if !target.running {
+		target.running = true
+		go queue.run(key, target)
+	}
+	return task.future
+}
+
+func (queue *sendQueue) run(key string, target *targetQueue) {
+	for {
+		queue.Lock()
+		if len(target.pending) == 0 {
+			target.running = false
+			queue.evict(key, target)
+			queue.Unlock()
+			return
+		}
+		task := target.pending[0]
+		target.pending = target.pending[1:]
+		queue.Unlock()
+		// ctx已结束的消息直接丢弃
+		if err := target.bucket.wait(task.ctx); err != nil {
+			task.future.resolve(nil, err)
+			continue
+		}
+		if err := queue.global.wait(task.ctx); err != nil {
+			task.future.resolve(nil, err)
+			continue
+		}
+		task.future.resolve(task.call())
+	}
+}
+
+// evict 会话空闲且令牌已恢复满时释放该会话，避免长期占用内存；令牌未满时等到恢复满再检查。调用方需持有锁
+func (queue *sendQueue) evict(key string, target *targetQueue) {
+	if target.running || len(target.pending) != 0 || queue.targets[key] != target {
+		return
+	}
+	delay := target.bucket.untilFull()
+	if delay <= 0 {
+		delete(queue.targets, key)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		queue.Lock()
+		defer queue.Unlock()
+		queue.evict(key, target)
+	})
+}
+
+func sendKey(eventType EventType, id int64) string {
+	return eventType.String() + ":" + strconv.FormatInt(id, 10)
+}
+
+// sendAsync 开启限速时进入发送队列，否则立即在新goroutine中发送
+func (bot *Bot) sendAsync(ctx context.Context, key string, call func() (*MessageCallBack, error)) *SendFuture {
+	if bot.config.RateLimit.Enable {
+		return bot.sendQueue.submit(ctx, key, call)
+	}
+	future := newSendFuture()
+	go func() {
+		future.resolve(call())
+	}()
+	return future
+}
@@ -0,0 +1,100 @@
+package ranni
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_sendQueue(t *testing.T) {
+	bot := New(&Config{RateLimit: RateLimitConfig{
+		Enable:     true,
+		TargetRate: 20,
+	}})
+	var lock sync.Mutex
+	var order []int
+	var futures []*SendFuture
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		i := i
+		futures = append(futures, bot.sendAsync(context.Background(), sendKey(GroupMessageEventType, 1), func() (*MessageCallBack, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			order = append(order, i)
+			return &MessageCallBack{}, nil
+		}))
+	}
+	// 另一个会话不受该会话限速影响
+	other := bot.sendAsync(context.Background(), sendKey(GroupMessageEventType, 2), func() (*MessageCallBack, error) {
+		return &MessageCallBack{}, nil
+	})
+	if _, err := other.Wait(); err != nil || time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("other target blocked: %v", time.Since(start))
+	}
+	for _, future := range futures {
+		if _, err := future.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 突发1条，其余4条按20条/秒发送
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Fatalf("rate limit not applied: %v", elapsed)
+	}
+	for i, v := range order {
+		if i != v {
+			t.Fatalf("out of order: %v", order)
+		}
+	}
+}
+
+func TestEventContext_SendAsync(t *testing.T) {
+	var sent int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&sent, 1)
+		_, _ = w.Write([]byte(`{"status":"ok","retcode":0,"data":{"message_id":1}}`))
+	}))
+	defer server.Close()
+	for _, rateLimit := range []bool{false, true} {
+		bot := New(&Config{CallBackAddr: server.URL, RateLimit: RateLimitConfig{Enable: rateLimit, TargetRate: 1}})
+		futures := make(chan *SendFuture, 1)
+		// handler返回后事件的context即被取消，异步发送不应受影响
+		bot.Register(funcHandler{do: func(ctx *EventContext) {
+			futures <- ctx.SendAsync(NewMsgChain().AddText("pong"))
+		}})
+		_, wg := bot.dispatch(GroupMessageEvent{GroupId: 1})
+		wg.Wait()
+		if _, err := (<-futures).Wait(); err != nil {
+			t.Fatalf("rateLimit=%v: %v", rateLimit, err)
+		}
+	}
+	if sent != 2 {
+		t.Errorf("server received %d messages, want 2", sent)
+	}
+}
+
+func Test_sendQueue_evict(t *testing.T) {
+	bot := New(&Config{RateLimit: RateLimitConfig{Enable: true, TargetRate: 20}})
+	future := bot.sendAsync(context.Background(), sendKey(GroupMessageEventType, 1), func() (*MessageCallBack, error) {
+		return &MessageCallBack{}, nil
+	})
+	if _, err := future.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	// 令牌在50ms后恢复满，之后空闲的会话应被释放
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		bot.sendQueue.Lock()
+		idle := len(bot.sendQueue.targets)
+		bot.sendQueue.Unlock()
+		if idle == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("idle target not evicted")
+}
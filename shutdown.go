@@ -0,0 +1,148 @@
+package ranni
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// Run 使用config运行默认bot，直到ctx结束
+func Run(ctx context.Context, config *Config) error {
+	engine.config = config
+	return engine.Run(ctx)
+}
+
+// Stop 优雅停止默认bot
+func Stop(ctx context.Context) error {
+	return engine.Stop(ctx)
+}
+
+// Start 启动bot并阻塞，收到中断信号后优雅退出
+func (bot *Bot) Start() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := bot.Run(ctx); err != nil {
+		log.Println("bot退出异常：", err)
+	}
+}
+
+// Run 启动bot并阻塞，直到ctx结束或连接无法恢复，随后在ShutdownTimeout内优雅退出
+func (bot *Bot) Run(ctx context.Context) error {
+	if _, _, err := bot.network(); err != nil {
+		return err
+	}
+	bot.storeLock.Lock()
+	if bot.store == nil {
+		store, err := bot.openStore()
+		if err != nil {
+			bot.storeLock.Unlock()
+			return err
+		}
+		bot.store = store
+	}
+	bot.storeLock.Unlock()
+	bot.registerPluginCommand()
+	//启动定时器
+	bot.cronClient.Start()
+	//启动web服务
+	bot.startServers()
+	loopDone := make(chan struct{})
+	bot.runLock.Lock()
+	bot.loopDone = loopDone
+	bot.runLock.Unlock()
+	go func() {
+		defer close(loopDone)
+		//反向ws或http post模式下等待cq-http推送事件
+		if bot.config.ReverseWs || bot.config.HttpPost {
+			<-bot.done
+			bot.reverseConns.closeAll()
+			return
+		}
+		//连接cq-http
+		bot.cqConnect()
+	}()
+	select {
+	case <-ctx.Done():
+	case <-loopDone:
+	}
+	stopCtx, cancel := context.WithTimeout(context.Background(), bot.config.shutdownTimeout())
+	defer cancel()
+	return bot.Stop(stopCtx)
+}
+
+// Stop 停止接收新事件，等待执行中的handler与定时任务结束后关闭web服务及连接，ctx结束时不再等待
+func (bot *Bot) Stop(ctx context.Context) error {
+	bot.runLock.Lock()
+	if bot.stopped {
+		bot.runLock.Unlock()
+		return nil
+	}
+	bot.stopped = true
+	loopDone := bot.loopDone
+	bot.runLock.Unlock()
+	bot.conversations.closeAll()
+
+	var err error
+	handlersDone := make(chan struct{})
+	go func() {
+		bot.running.Wait()
+		close(handlersDone)
+	}()
+	select {
+	case <-handlersDone:
+	case <-ctx.Done():
+		log.Println("等待handler执行结束超时")
+		bot.cancelBase()
+		err = ctx.Err()
+	}
+	select {
+	case <-bot.cronClient.Stop().Done():
+	case <-ctx.Done():
+		log.Println("等待定时任务执行结束超时")
+		err = ctx.Err()
+	}
+	if e := bot.shutdownHandlers(ctx); e != nil {
+		log.Println("等待handler关闭超时")
+		err = e
+	}
+	for _, server := range bot.servers {
+		if e := server.Shutdown(ctx); e != nil {
+			log.Println("web服务关闭异常：", e)
+			err = e
+		}
+	}
+	bot.stopHeartbeatWatchdog()
+	bot.cancelBase()
+	close(bot.done)
+	if loopDone != nil {
+		select {
+		case <-loopDone:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+// acquire 登记一个执行中的handler，bot已停止时返回false
+func (bot *Bot) acquire() bool {
+	bot.runLock.RLock()
+	defer bot.runLock.RUnlock()
+	if bot.stopped {
+		return false
+	}
+	bot.running.Add(1)
+	return true
+}
+
+// eventCtx 创建事件的context，配置了HandlerTimeout时超时后取消
+func (bot *Bot) eventCtx() (context.Context, context.CancelFunc) {
+	if timeout := bot.config.HandlerTimeout; timeout > 0 {
+		return context.WithTimeout(bot.baseCtx, timeout)
+	}
+	return context.WithCancel(bot.baseCtx)
+}
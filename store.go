@@ -0,0 +1,207 @@
+package ranni
+
+import (
+	json "github.com/json-iterator/go"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store 键值存储，保存冷却、配额、权限等需要跨事件保留的状态
+type Store interface {
+	Get(key string) ([]byte, bool, error)
+	// Set 保存value，ttl小于等于0时不过期
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+	// Keys 返回以prefix开头的全部key
+	Keys(prefix string) ([]string, error)
+}
+
+type storeEntry struct {
+	Value    []byte `json:"value"`
+	ExpireAt int64  `json:"expire_at,omitempty"` // unix纳秒，0为不过期
+}
+
+func (entry storeEntry) expired(now time.Time) bool {
+	return entry.ExpireAt != 0 && now.UnixNano() >= entry.ExpireAt
+}
+
+func newStoreEntry(value []byte, ttl time.Duration) storeEntry {
+	entry := storeEntry{Value: value}
+	if ttl > 0 {
+		entry.ExpireAt = time.Now().Add(ttl).UnixNano()
+	}
+	return entry
+}
+
+// minPurgeSize 条目数超过上次清理后的两倍且不少于该值时清理过期项
+const minPurgeSize = 64
+
+// MemoryStore 保存在内存中的Store，进程退出后丢失。
+// 过期项在读取时删除，写入使条目数翻倍时整体清理一次，不会随不再访问的key无限增长
+type MemoryStore struct {
+	lock      sync.RWMutex
+	entries   map[string]storeEntry
+	purgeSize int // 条目数达到该值时清理过期项
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]storeEntry)}
+}
+
+func (store *MemoryStore) Get(key string) ([]byte, bool, error) {
+	store.lock.RLock()
+	entry, ok := store.entries[key]
+	store.lock.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	if now := time.Now(); entry.expired(now) {
+		store.lock.Lock()
+		defer store.lock.Unlock()
+		if entry, ok := store.entries[key]; ok && entry.expired(now) {
+			delete(store.entries, key)
+		}
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+func (store *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.set(key, value, ttl)
+	return nil
+}
+
+// set 写入并在条目数翻倍时清理过期项，调用方需持有写锁
+func (store *MemoryStore) set(key string, value []byte, ttl time.Duration) {
+	store.entries[key] = newStoreEntry(value, ttl)
+	if len(store.entries) < store.purgeSize || len(store.entries) < minPurgeSize {
+		return
+	}
+	store.keys("")
+	store.purgeSize = len(store.entries) * 2
+}
+
+func (store *MemoryStore) Delete(key string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.entries, key)
+	return nil
+}
+
+func (store *MemoryStore) Keys(prefix string) ([]string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.keys(prefix), nil
+}
+
+// keys 返回未过期的key并顺带清理过期项，调用方需持有写锁
+func (store *MemoryStore) keys(prefix string) []string {
+	now := time.Now()
+	var keys []string
+	for key, entry := range store.entries {
+		if entry.expired(now) {
+			delete(store.entries, key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FileStore 持久化到json文件的Store，每次修改后整体写入文件
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+// NewFileStore 打开path处的存储文件，文件不存在时创建
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{path: path}
+	store.entries = make(map[string]storeEntry)
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(content) != 0 {
+		if err := json.Unmarshal(content, &store.entries); err != nil {
+			return nil, err
+		}
+	}
+	store.keys("")
+	return store, nil
+}
+
+func (store *FileStore) Set(key string, value []byte, ttl time.Duration) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.entries[key] = newStoreEntry(value, ttl)
+	return store.save()
+}
+
+func (store *FileStore) Delete(key string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.entries, key)
+	return store.save()
+}
+
+// save 先写入临时文件再替换，避免写入中途退出损坏文件，调用方需持有写锁
+func (store *FileStore) save() error {
+	store.keys("")
+	content, err := json.Marshal(store.entries)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(store.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := store.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, store.path)
+}
+
+// Store 返回bot使用的存储，配置了StorePath时持久化到文件，否则保存在内存
+func (bot *Bot) Store() Store {
+	bot.storeLock.Lock()
+	defer bot.storeLock.Unlock()
+	if bot.store == nil {
+		store, err := bot.openStore()
+		if err != nil {
+			log.Println("打开存储文件失败，改为保存在内存中：", err)
+			store = NewMemoryStore()
+		}
+		bot.store = store
+	}
+	return bot.store
+}
+
+// SetStore 替换bot使用的存储，如使用redis等外部存储
+func (bot *Bot) SetStore(store Store) {
+	bot.storeLock.Lock()
+	defer bot.storeLock.Unlock()
+	bot.store = store
+}
+
+func (bot *Bot) openStore() (Store, error) {
+	if bot.config == nil || bot.config.StorePath == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewFileStore(bot.config.StorePath)
+}
@@ -0,0 +1,163 @@
+package ranni
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	json "github.com/json-iterator/go"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	HttpTransport = "http" // 通过CallBackAddr的http接口调用action
+	WsTransport   = "ws"   // 通过已建立的ws连接调用action
+
+	defaultActionTimeout = 30 * time.Second
+)
+
+// Transport 调用OneBot action的通道
+type Transport interface {
+	// Call 调用action，返回完整的响应内容，ctx结束时放弃等待
+	Call(ctx context.Context, action string, params interface{}) ([]byte, error)
+}
+
+type httpTransport struct {
+	bot *Bot
+}
+
+func (transport httpTransport) Call(ctx context.Context, action string, params interface{}) ([]byte, error) {
+	config := transport.bot.config
+	if config.ProtocolVersion == OneBot12 {
+		// v12的http动作统一请求根路径
+		return transport.bot.postJsonBody(ctx, config.callBackAddr(), actionFrame{Action: action, Params: params})
+	}
+	return transport.bot.postJsonBody(ctx, config.callBackAddr()+"/"+action, params)
+}
+
+type actionFrame struct {
+	Action string      `json:"action"`
+	Params interface{} `json:"params"`
+	Echo   string      `json:"echo"`
+}
+
+// wsTransport 通过ws发送action，并按echo匹配响应
+type wsTransport struct {
+	bot         *Bot
+	seq         uint64
+	writeLock   sync.Mutex
+	conn        *websocket.Conn
+	pendingLock sync.Mutex
+	pending     map[string]chan []byte
+}
+
+func (transport *wsTransport) setConn(conn *websocket.Conn) {
+	transport.writeLock.Lock()
+	defer transport.writeLock.Unlock()
+	transport.conn = conn
+}
+
+// clearConn 连接断开时清除，若当前连接已被替换则忽略
+func (transport *wsTransport) clearConn(conn *websocket.Conn) {
+	transport.writeLock.Lock()
+	defer transport.writeLock.Unlock()
+	if transport.conn == conn {
+		transport.conn = nil
+	}
+}
+
+func (transport *wsTransport) Call(ctx context.Context, action string, params interface{}) ([]byte, error) {
+	echo := strconv.FormatUint(atomic.AddUint64(&transport.seq, 1), 10)
+	resp := make(chan []byte, 1)
+	transport.pendingLock.Lock()
+	if transport.pending == nil {
+		transport.pending = make(map[string]chan []byte)
+	}
+	transport.pending[echo] = resp
+	transport.pendingLock.Unlock()
+	defer func() {
+		transport.pendingLock.Lock()
+		delete(transport.pending, echo)
+		transport.pendingLock.Unlock()
+	}()
+	if err := transport.write(actionFrame{Action: action, Params: params, Echo: echo}); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(transport.bot.config.actionTimeout())
+	defer timer.Stop()
+	select {
+	case body := <-resp:
+		return body, nil
+	case <-timer.C:
+		return nil, errors.New("调用" + action + "超时")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (transport *wsTransport) write(frame actionFrame) error {
+	transport.writeLock.Lock()
+	defer transport.writeLock.Unlock()
+	if transport.conn == nil {
+		return errors.New("ws未连接")
+	}
+	return transport.conn.WriteJSON(frame)
+}
+
+// resolve 若message为action的响应则交给等待中的调用方，返回是否已处理
+func (transport *wsTransport) resolve(message []byte) bool {
+	echo := json.Get(message, "echo")
+	if echo.ValueType() == json.InvalidValue || json.Get(message, "post_type").ValueType() != json.InvalidValue {
+		return false
+	}
+	transport.pendingLock.Lock()
+	resp, ok := transport.pending[echo.ToString()]
+	transport.pendingLock.Unlock()
+	if ok {
+		resp <- message
+	}
+	return true
+}
+
+// callAction 通过配置的通道调用action，resp不为nil时将响应解析到resp中
+func (bot *Bot) callAction(ctx context.Context, action string, params interface{}, resp interface{}) error {
+	body, err := bot.callActionBody(ctx, action, params)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(body, resp)
+}
+
+func (bot *Bot) callActionBody(ctx context.Context, action string, params interface{}) ([]byte, error) {
+	if params == nil {
+		params = struct{}{}
+	}
+	action = strings.TrimPrefix(action, "/")
+	protocol := bot.protocol()
+	name, params, err := protocol.action(ctx, action, params)
+	if err != nil {
+		return nil, err
+	}
+	body, err := bot.transport().Call(ctx, name, params)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			apiErr.Action = action
+		}
+		return nil, err
+	}
+	body, err = protocol.normalizeResponse(action, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(action, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
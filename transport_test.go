@@ -0,0 +1,79 @@
+package ranni
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	json "github.com/json-iterator/go"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_wsTransport_Call(t *testing.T) {
+	// 模拟cq-http：乱序返回两个action的响应
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var frames []actionFrame
+		for len(frames) < 2 {
+			frame := actionFrame{}
+			if err := conn.ReadJSON(&frame); err != nil {
+				return
+			}
+			frames = append(frames, frame)
+		}
+		for i := len(frames) - 1; i >= 0; i-- {
+			_ = conn.WriteJSON(map[string]interface{}{
+				"status":  "ok",
+				"retcode": 0,
+				"data":    map[string]string{"action": frames[i].Action},
+				"echo":    frames[i].Echo,
+			})
+		}
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	transport := &New(&Config{ActionTimeout: time.Second}).wsActions
+	transport.setConn(conn)
+	go func() {
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			transport.resolve(message)
+		}
+	}()
+
+	results := make(chan string, 2)
+	for _, action := range []string{"send_msg", "get_login_info"} {
+		go func(action string) {
+			body, err := transport.Call(context.Background(), action, nil)
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			if got := json.Get(body, "data", "action").ToString(); got != action {
+				results <- "got response of " + got + " for " + action
+				return
+			}
+			results <- ""
+		}(action)
+	}
+	for i := 0; i < 2; i++ {
+		if msg := <-results; msg != "" {
+			t.Fatal(msg)
+		}
+	}
+}